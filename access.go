@@ -0,0 +1,45 @@
+package emu
+
+import (
+	"fmt"
+)
+
+// MemAccess is a single memory read or write recorded by LogAccesses.
+type MemAccess struct {
+	PC    uint16 // address of the instruction that made the access
+	Addr  uint16
+	Value uint8
+	Write bool
+}
+
+func (a MemAccess) String() string {
+	dir := "R"
+	if a.Write {
+		dir = "W"
+	}
+	return fmt.Sprintf("$%04X: %s $%04X $%02X", a.PC, dir, a.Addr, a.Value)
+}
+
+// AccessLog returns the logged memory accesses, oldest first.  Opcode and
+// operand fetches are included.  It is nil unless the core was created with
+// LogAccesses.
+func (c *Core) AccessLog() []MemAccess {
+	if c.accessLog == nil {
+		return nil
+	}
+
+	log := make([]MemAccess, 0, c.accessLen)
+	start := c.accessIdx - c.accessLen + len(c.accessLog)
+	for i := 0; i < c.accessLen; i++ {
+		log = append(log, c.accessLog[(start+i)%len(c.accessLog)])
+	}
+	return log
+}
+
+func (c *Core) logAccess(addr uint16, value uint8, write bool) {
+	c.accessLog[c.accessIdx] = MemAccess{PC: c.PC, Addr: addr, Value: value, Write: write}
+	c.accessIdx = (c.accessIdx + 1) % len(c.accessLog)
+	if c.accessLen < len(c.accessLog) {
+		c.accessLen++
+	}
+}
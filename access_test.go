@@ -0,0 +1,66 @@
+package emu
+
+import (
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_ZP, 0x10, // $8000
+		OP_STA_ZP, 0x11, // $8002
+		0xFF, // $8004
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if core.AccessLog() != nil {
+		t.Fatal("Access log should be nil when not logging")
+	}
+
+	exp := []MemAccess{
+		{0x8000, 0x8000, OP_LDA_ZP, false},
+		{0x8000, 0x8001, 0x10, false},
+		{0x8000, 0x0010, 0x42, false},
+		{0x8002, 0x8002, OP_STA_ZP, false},
+		{0x8002, 0x8003, 0x11, false},
+		{0x8002, 0x0011, 0x42, true},
+		{0x8004, 0x8004, 0xFF, false},
+	}
+
+	for _, size := range []int{100, 3} {
+		core, err = NewCore(rom, false, 0, LogAccesses(size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		core.SetTrap(0xFF, haltTrap)
+		core.memory[0x10] = 0x42
+
+		// Construction reads the reset vector.
+		start := len(core.AccessLog())
+
+		if err = core.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		got := core.AccessLog()
+		want := exp
+		if size < len(exp) {
+			want = exp[len(exp)-size:]
+		} else {
+			got = got[start:]
+		}
+
+		if len(got) != len(want) {
+			t.Fatalf("size %d: Incorrect access count: Exp:%d Got:%d\n%v", size, len(want), len(got), got)
+		}
+
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("size %d: Incorrect access %d: Exp:%v Got:%v", size, i, want[i], got[i])
+			}
+		}
+	}
+}
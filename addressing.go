@@ -4,14 +4,61 @@ import (
 	"fmt"
 )
 
+// readZeroPageWord reads a pointer from the zero page.  The high byte wraps
+// around to $00 when the pointer is at $FF.
+func (c *Core) readZeroPageWord(addr uint8) uint16 {
+	return uint16(c.ReadByte(uint16(addr))) | uint16(c.ReadByte(uint16(addr+1)))<<8
+}
+
+// readIndirect reads the pointer for JMP (Indirect).  The NMOS 6502 doesn't
+// carry into the high byte of the pointer, so a pointer at $xxFF takes its
+// high byte from $xx00.  The 65C02 fixed this.
+func (c *Core) readIndirect(ptr uint16) uint16 {
+	if c.variant == VariantNMOS && ptr&0x00FF == 0x00FF {
+		return uint16(c.ReadByte(ptr)) | uint16(c.ReadByte(ptr&0xFF00))<<8
+	}
+	return c.ReadWord(ptr)
+}
+
+// peekIndirect is the side effect free version of readIndirect.
+func (c *Core) peekIndirect(ptr uint16) uint16 {
+	if c.variant == VariantNMOS && ptr&0x00FF == 0x00FF {
+		return uint16(c.PeekByte(ptr)) | uint16(c.PeekByte(ptr&0xFF00))<<8
+	}
+	return c.PeekWord(ptr)
+}
+
+// indexed adds index to base.  With dummy reads enabled, crossing a page
+// first reads from the address before the high byte is carried, like the
+// NMOS 6502 does.
+func (c *Core) indexed(base uint16, index uint8) uint16 {
+	addr := base + uint16(index)
+	if c.dummyReads && addr&0xFF00 != base&0xFF00 {
+		c.ReadByte(base&0xFF00 | addr&0x00FF)
+	}
+	return addr
+}
+
 type AddressModeMeta struct {
 	Name string
+	Length uint8 // instruction length in bytes, including the opcode
 	Asm func(c *Core, oppc uint16) string
+
+	// Address resolves the effective address for the instruction at the
+	// current PC and returns it along with the length of the instruction.
+	// It must not modify the PC; instructions advance it after executing.
 	Address func(c *Core) (uint16, uint8)
 }
 
+// Size returns the length in bytes of an instruction using this mode without
+// reading memory.
+func (m AddressModeMeta) Size() uint8 {
+	return m.Length
+}
+
 var ADDR_Absolute = AddressModeMeta{
 		Name: "Absolute",
+		Length: 3,
 		Asm: func(c *Core, oppc uint16) string {
 			return fmt.Sprintf("$%04X", c.ReadWord(oppc+1))
 		},
@@ -22,6 +69,7 @@ var ADDR_Absolute = AddressModeMeta{
 
 var ADDR_AbsoluteX = AddressModeMeta{
 		Name: "Absolute, X",
+		Length: 3,
 		Asm: func(c *Core, oppc uint16) string {
 			value := c.ReadWord(oppc+1)
 			return fmt.Sprintf("$%04X, X @ $%04X",
@@ -30,12 +78,13 @@ var ADDR_AbsoluteX = AddressModeMeta{
 			)
 		},
 		Address: func(c *Core) (uint16, uint8) {
-			return c.ReadWord(c.PC + 1) + uint16(c.X), 3
+			return c.indexed(c.ReadWord(c.PC + 1), c.X), 3
 		},
 	}
 
 var ADDR_AbsoluteY = AddressModeMeta{
 		Name: "Absolute, Y",
+		Length: 3,
 		Asm: func(c *Core, oppc uint16) string {
 			value := c.ReadWord(oppc+1)
 			return fmt.Sprintf("$%04X, Y @ $%04X",
@@ -44,12 +93,26 @@ var ADDR_AbsoluteY = AddressModeMeta{
 			)
 		},
 		Address: func(c *Core) (uint16, uint8) {
-			return c.ReadWord(c.PC + 1) + uint16(c.Y), 3
+			return c.indexed(c.ReadWord(c.PC + 1), c.Y), 3
+		},
+	}
+
+// Operates on the accumulator rather than memory.  Instructions using this
+// mode read and write c.A directly; Address only reports the length.
+var ADDR_Accumulator = AddressModeMeta{
+		Name: "Accumulator",
+		Length: 1,
+		Asm: func(c *Core, oppc uint16) string {
+			return "A"
+		},
+		Address: func(c *Core) (uint16, uint8) {
+			return c.PC, 1
 		},
 	}
 
 var ADDR_Immediate = AddressModeMeta{
 		Name: "#Immediate",
+		Length: 2,
 		Asm: func(c *Core, oppc uint16) string {
 			return fmt.Sprintf("#$%02X", c.ReadByte(oppc+1))
 		},
@@ -58,8 +121,10 @@ var ADDR_Immediate = AddressModeMeta{
 		},
 	}
 
+// No operand.  Asm renders nothing so the mnemonic stands alone.
 var ADDR_Implied = AddressModeMeta{
 		Name: "Implied",
+		Length: 1,
 		Asm: func(c *Core, oppc uint16) string {
 			return ""
 		},
@@ -70,48 +135,84 @@ var ADDR_Implied = AddressModeMeta{
 
 var ADDR_Indirect = AddressModeMeta{
 		Name: "(Indirect)",
+		Length: 3,
 		Asm: func(c *Core, oppc uint16) string {
 			value := c.ReadWord(oppc+1)
 			return fmt.Sprintf("($%04X) @ $%04X",
 				value,
-				c.ReadWord(value),
+				c.readIndirect(value),
+			)
+		},
+		Address: func(c *Core) (uint16, uint8) {
+			return c.readIndirect(c.ReadWord(c.PC + 1)), 3
+		},
+	}
+
+// 65C02 only.  JMP through a table of pointers indexed by X.
+var ADDR_AbsoluteIndirectX = AddressModeMeta{
+		Name: "(Absolute, X)",
+		Length: 3,
+		Asm: func(c *Core, oppc uint16) string {
+			value := c.ReadWord(oppc+1)
+			return fmt.Sprintf("($%04X, X) @ $%04X",
+				value,
+				c.ReadWord(value+uint16(c.X)),
 			)
 		},
 		Address: func(c *Core) (uint16, uint8) {
-			return c.ReadWord(c.ReadWord(c.PC + 1)), 3
+			return c.ReadWord(c.ReadWord(c.PC + 1) + uint16(c.X)), 3
 		},
 	}
 
 var ADDR_IndirectX = AddressModeMeta{
 		Name: "(Indirect), X",
+		Length: 2,
 		Asm: func(c *Core, oppc uint16) string {
-			value := c.ReadWord(uint16(c.ReadByte(oppc+1)))
-			return fmt.Sprintf("($%04X), X @ $%04X",
+			value := c.ReadByte(oppc+1)
+			return fmt.Sprintf("($%02X, X) @ $%04X",
 				value,
-				c.ReadWord(value+uint16(c.X)),
+				c.readZeroPageWord(value+c.X),
 			)
 		},
 		Address: func(c *Core) (uint16, uint8) {
-			return c.ReadWord(uint16(c.ReadByte(c.PC + 1) + c.X)), 2
+			return c.readZeroPageWord(c.ReadByte(c.PC + 1) + c.X), 2
 		},
 	}
 
 var ADDR_IndirectY = AddressModeMeta{
 		Name: "(Indirect, Y)",
+		Length: 2,
 		Asm: func(c *Core, oppc uint16) string {
-			value := c.ReadWord(uint16(c.ReadByte(oppc+1)))
-			return fmt.Sprintf("($%04X, Y) @ $%04X",
+			value := c.ReadByte(oppc+1)
+			return fmt.Sprintf("($%02X), Y @ $%04X",
 				value,
-				c.ReadWord(value)+uint16(c.Y),
+				c.readZeroPageWord(value)+uint16(c.Y),
 			)
 		},
 		Address: func(c *Core) (uint16, uint8) {
-			return c.ReadWord(uint16(c.ReadByte(uint16(c.PC + 1)))) + uint16(c.Y), 2
+			return c.indexed(c.readZeroPageWord(c.ReadByte(c.PC + 1)), c.Y), 2
+		},
+	}
+
+// 65C02 only.  Like (Indirect), Y without the index.
+var ADDR_IndirectZP = AddressModeMeta{
+		Name: "(Indirect ZeroPage)",
+		Length: 2,
+		Asm: func(c *Core, oppc uint16) string {
+			value := c.ReadByte(oppc+1)
+			return fmt.Sprintf("($%02X) @ $%04X",
+				value,
+				c.readZeroPageWord(value),
+			)
+		},
+		Address: func(c *Core) (uint16, uint8) {
+			return c.readZeroPageWord(c.ReadByte(c.PC + 1)), 2
 		},
 	}
 
 var ADDR_ZeroPage = AddressModeMeta{
 		Name: "ZeroPage",
+		Length: 2,
 		Asm: func(c *Core, oppc uint16) string {
 			value := c.ReadByte(oppc+1)
 			return fmt.Sprintf("$%02X", value)
@@ -121,8 +222,11 @@ var ADDR_ZeroPage = AddressModeMeta{
 		},
 	}
 
+// The index is added with 8-bit math so ZeroPageX and ZeroPageY always wrap
+// around within the zero page.
 var ADDR_ZeroPageX = AddressModeMeta{
 		Name: "ZeroPage, X",
+		Length: 2,
 		Asm: func(c *Core, oppc uint16) string {
 			value := c.ReadByte(oppc+1)
 			return fmt.Sprintf("$%02X, X   @ $%04X",
@@ -137,6 +241,7 @@ var ADDR_ZeroPageX = AddressModeMeta{
 
 var ADDR_ZeroPageY = AddressModeMeta{
 		Name: "ZeroPage, Y",
+		Length: 2,
 		Asm: func(c *Core, oppc uint16) string {
 			value := c.ReadByte(oppc+1)
 			return fmt.Sprintf("$%02X, Y   @ $%04X",
@@ -149,8 +254,25 @@ var ADDR_ZeroPageY = AddressModeMeta{
 		},
 	}
 
+// Rockwell BBR and BBS.  The zero page operand is followed by a branch
+// offset relative to the end of the three byte instruction.
+var ADDR_ZeroPageRelative = AddressModeMeta{
+		Name: "ZeroPage, Relative",
+		Length: 3,
+		Asm: func(c *Core, oppc uint16) string {
+			return fmt.Sprintf("$%02X, $%04X",
+				c.ReadByte(oppc+1),
+				c.addrRelative(oppc+1, c.ReadByte(oppc+2)),
+			)
+		},
+		Address: func(c *Core) (uint16, uint8) {
+			return uint16(c.ReadByte(c.PC + 1)), 3
+		},
+	}
+
 var ADDR_Relative = AddressModeMeta{
 		Name: "Relative",
+		Length: 2,
 		Asm: func(c *Core, oppc uint16) string {
 			value := c.addrRelative(oppc, c.ReadByte(oppc +1))
 			n, neg := TwosCompInv(c.ReadByte(oppc + 1))
@@ -0,0 +1,225 @@
+package emu
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestZeroPageWrap(t *testing.T) {
+	regA := func(c *Core) uint8 { return c.A }
+	regX := func(c *Core) uint8 { return c.X }
+
+	tests := []struct {
+		name string
+		rom  []byte
+		x    uint8
+		y    uint8
+		reg  func(c *Core) uint8
+		want uint8
+	}{
+		// pointer at $FF + 1 = $00, pointing to $0302
+		{"OP_LDA_IX wrapped index", []byte{OP_LDA_IX, 0xFF}, 0x01, 0x00, regA, 0x11},
+		// pointer split across $FF and $00, pointing to $0201
+		{"OP_LDA_IX split pointer", []byte{OP_LDA_IX, 0xFE}, 0x01, 0x00, regA, 0x22},
+		// $FF + 2 = $01, not $0101
+		{"OP_LDA_ZX", []byte{OP_LDA_ZX, 0xFF}, 0x02, 0x00, regA, 0x03},
+		{"OP_LDX_ZY", []byte{OP_LDX_ZY, 0xFF}, 0x00, 0x02, regX, 0x03},
+		// pointer split across $FF and $00, $0201 + 1
+		{"OP_LDA_IY split pointer", []byte{OP_LDA_IY, 0xFF}, 0x00, 0x01, regA, 0x44},
+	}
+
+	core := newTestCore(t)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := core.resetTest(t, tc.rom, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			core.memory[0x00] = 0x02
+			core.memory[0x01] = 0x03
+			core.memory[0xFF] = 0x01
+			core.memory[0x0101] = 0x99
+			core.memory[0x0201] = 0x22
+			core.memory[0x0202] = 0x44
+			core.memory[0x0302] = 0x11
+			core.X = tc.x
+			core.Y = tc.y
+
+			if err = core.tick(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := tc.reg(core); got != tc.want {
+				t.Errorf("Incorrect value: Exp:$%02X Got:$%02X", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestAddressModeSize(t *testing.T) {
+	tests := []struct {
+		mode AddressModeMeta
+		size uint8
+	}{
+		{ADDR_Absolute, 3},
+		{ADDR_AbsoluteX, 3},
+		{ADDR_AbsoluteY, 3},
+		{ADDR_Accumulator, 1},
+		{ADDR_Immediate, 2},
+		{ADDR_Implied, 1},
+		{ADDR_Indirect, 3},
+		{ADDR_IndirectX, 2},
+		{ADDR_IndirectY, 2},
+		{ADDR_ZeroPage, 2},
+		{ADDR_ZeroPageX, 2},
+		{ADDR_ZeroPageY, 2},
+		{ADDR_Relative, 2},
+	}
+
+	core := newTestCore(t)
+	if err := core.resetTest(t, []byte{OP_NOP}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range tests {
+		if tc.mode.Size() != tc.size {
+			t.Errorf("%s: Incorrect size: Exp:%d Got:%d", tc.mode.Name, tc.size, tc.mode.Size())
+		}
+
+		// Relative can't be resolved without branching.
+		if tc.mode.Name == ADDR_Relative.Name {
+			continue
+		}
+
+		if _, size := tc.mode.Address(core); size != tc.mode.Size() {
+			t.Errorf("%s: Size doesn't match Address: Exp:%d Got:%d", tc.mode.Name, size, tc.mode.Size())
+		}
+	}
+}
+
+func TestDummyReads(t *testing.T) {
+	tests := []struct {
+		name  string
+		rom   []byte
+		dummy bool
+		reads []uint16
+	}{
+		{"AX crossing", []byte{OP_LDA_AX, 0xFF, 0x20}, true, []uint16{0x2000, 0x2100}},
+		{"AX same page", []byte{OP_LDA_AX, 0x10, 0x20}, true, []uint16{0x2011}},
+		{"AY crossing", []byte{OP_LDA_AY, 0xFF, 0x20}, true, []uint16{0x2000, 0x2100}},
+		{"IY crossing", []byte{OP_LDA_IY, 0x10}, true, []uint16{0x2000, 0x2100}},
+		{"disabled", []byte{OP_LDA_AX, 0xFF, 0x20}, false, []uint16{0x2100}},
+	}
+
+	for _, tc := range tests {
+		opts := []Option{}
+		if tc.dummy {
+			opts = append(opts, DummyReads())
+		}
+
+		rom := PadWithVectors(append(tc.rom, 0xFF), 0x8000, 0x8000, 0x8000)
+		core, err := NewCore(rom, false, 0, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		core.SetTrap(0xFF, haltTrap)
+		core.X = 0x01
+		core.Y = 0x01
+		core.memory[0x10] = 0xFF // pointer to $20FF
+		core.memory[0x11] = 0x20
+
+		reads := []uint16{}
+		core.MapRead(0x2000, 0x21FF, func(addr uint16) uint8 {
+			reads = append(reads, addr)
+			return 0x00
+		})
+
+		if err = core.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		if fmt.Sprint(reads) != fmt.Sprint(tc.reads) {
+			t.Errorf("%s: Incorrect reads: Exp:%04X Got:%04X", tc.name, tc.reads, reads)
+		}
+	}
+}
+
+// Instructions near $FFFF fetch their operands from the start of memory, and
+// effective addresses past $FFFF wrap around to the zero page.
+func TestEndOfMemoryWrap(t *testing.T) {
+	tests := []struct {
+		name    string
+		variant Variant
+		pc      uint16
+		code    []byte
+		x       uint8
+		y       uint8
+		mode    AddressModeMeta
+		want    uint16
+	}{
+		{"Absolute operand split", VariantNMOS, 0xFFFE, []byte{OP_LDA_AB, 0x10, 0x02}, 0, 0, ADDR_Absolute, 0x0210},
+		{"Absolute operand wrapped", VariantNMOS, 0xFFFF, []byte{OP_LDA_AB, 0x10, 0x02}, 0, 0, ADDR_Absolute, 0x0210},
+		{"AbsoluteX", VariantNMOS, 0xFFFD, []byte{OP_LDA_AX, 0xF0, 0xFF}, 0x20, 0, ADDR_AbsoluteX, 0x0010},
+		{"AbsoluteY", VariantNMOS, 0xFFFF, []byte{OP_LDA_AY, 0xF0, 0xFF}, 0, 0x20, ADDR_AbsoluteY, 0x0010},
+		// NMOS takes the high byte from $FF00, CMOS from $0000.
+		{"Indirect NMOS", VariantNMOS, 0xFFFC, []byte{OP_JMP_ID, 0xFF, 0xFF}, 0, 0, ADDR_Indirect, 0x5634},
+		{"Indirect 65C02", Variant65C02, 0xFFFC, []byte{OP_JMP_ID, 0xFF, 0xFF}, 0, 0, ADDR_Indirect, 0x3434},
+		{"Indirect operand wrapped", VariantNMOS, 0xFFFF, []byte{OP_JMP_ID, 0x00, 0x03}, 0, 0, ADDR_Indirect, 0x7856},
+		{"AbsoluteIndirectX", Variant65C02, 0xFFFC, []byte{OP_JMP_AX, 0xF0, 0xFF}, 0x10, 0, ADDR_AbsoluteIndirectX, 0x1234},
+		// Operand $80 at $0000, pointer at $FF with its high byte at $00.
+		{"IndirectX", VariantNMOS, 0xFFFF, []byte{OP_LDA_IX, 0x80}, 0x7F, 0, ADDR_IndirectX, 0x8010},
+		{"IndirectY", VariantNMOS, 0xFFFE, []byte{OP_LDA_IY, 0x40}, 0, 0x20, ADDR_IndirectY, 0x0010},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mem := make([]byte, 0x10000)
+			mem[0x0000] = 0x34
+			mem[0x0001] = 0x12
+			mem[0x0040] = 0xF0 // pointer to $FFF0
+			mem[0x0041] = 0xFF
+			mem[0x00FF] = 0x10
+			mem[0x0300] = 0x56 // pointer to $7856
+			mem[0x0301] = 0x78
+			mem[0xFF00] = 0x56
+			mem[0xFFFF] = 0x34
+
+			for i, b := range tc.code {
+				mem[tc.pc+uint16(i)] = b
+			}
+			mem[tc.want] = 0x5A
+
+			core, err := NewRWCore(mem, 0, StartPC(tc.pc), CPUVariant(tc.variant))
+			if err != nil {
+				t.Fatal(err)
+			}
+			core.X = tc.x
+			core.Y = tc.y
+
+			if addr, _ := tc.mode.Address(core); addr != tc.want {
+				t.Errorf("Incorrect address: Exp:$%04X Got:$%04X", tc.want, addr)
+			}
+
+			if err = core.Step(); err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.code[0] == OP_JMP_ID || tc.code[0] == OP_JMP_AX {
+				if core.PC != tc.want {
+					t.Errorf("Incorrect PC: Exp:$%04X Got:$%04X", tc.want, core.PC)
+				}
+				return
+			}
+
+			if core.A != 0x5A {
+				t.Errorf("Incorrect A: Exp:$5A Got:$%02X", core.A)
+			}
+
+			next := tc.pc + uint16(tc.mode.Size())
+			if core.PC != next {
+				t.Errorf("Incorrect PC: Exp:$%04X Got:$%04X", next, core.PC)
+			}
+		})
+	}
+}
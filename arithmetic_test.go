@@ -0,0 +1,160 @@
+package emu
+
+import (
+	"testing"
+)
+
+// Overflow is set when the sign of the result is wrong for the signed
+// inputs: adding two numbers with the same sign, or subtracting a number
+// with the opposite sign, that gives a result outside of -128..127.
+func TestADCSBCFlags(t *testing.T) {
+	const (
+		C = FLAG_CARRY
+		Z = FLAG_ZERO
+		V = FLAG_OVERFLOW
+		N = FLAG_NEGATIVE
+	)
+
+	tests := []struct {
+		op      byte
+		a       uint8
+		m       uint8
+		carryIn bool
+		result  uint8
+		flags   uint8
+	}{
+		// ADC, carry clear
+		{OP_ADC_IM, 0x01, 0x01, false, 0x02, 0},         // 1 + 1 = 2
+		{OP_ADC_IM, 0x01, 0xFF, false, 0x00, C | Z},     // 1 + -1 = 0
+		{OP_ADC_IM, 0x7F, 0x01, false, 0x80, N | V},     // 127 + 1 = 128
+		{OP_ADC_IM, 0x80, 0xFF, false, 0x7F, C | V},     // -128 + -1 = -129
+		{OP_ADC_IM, 0x80, 0x80, false, 0x00, C | Z | V}, // -128 + -128 = -256
+		{OP_ADC_IM, 0x3F, 0x40, false, 0x7F, 0},         // 63 + 64 = 127
+		{OP_ADC_IM, 0x50, 0x50, false, 0xA0, N | V},     // 80 + 80 = 160
+		{OP_ADC_IM, 0xD0, 0x90, false, 0x60, C | V},     // -48 + -112 = -160
+		{OP_ADC_IM, 0xD0, 0xD0, false, 0xA0, C | N},     // -48 + -48 = -96
+		{OP_ADC_IM, 0x00, 0x00, false, 0x00, Z},
+
+		// ADC, carry set
+		{OP_ADC_IM, 0x00, 0x00, true, 0x01, 0},
+		{OP_ADC_IM, 0x7F, 0x00, true, 0x80, N | V}, // 127 + 0 + 1 = 128
+		{OP_ADC_IM, 0xFF, 0x00, true, 0x00, C | Z}, // -1 + 0 + 1 = 0
+		{OP_ADC_IM, 0x3F, 0x40, true, 0x80, N | V}, // 63 + 64 + 1 = 128
+		{OP_ADC_IM, 0x80, 0xFF, true, 0x80, C | N}, // -128 + -1 + 1 = -128
+		{OP_ADC_IM, 0xFF, 0xFF, true, 0xFF, C | N}, // -1 + -1 + 1 = -1
+
+		// SBC, carry set (no borrow)
+		{OP_SBC_IM, 0x50, 0xF0, true, 0x60, 0},     // 80 - -16 = 96
+		{OP_SBC_IM, 0x50, 0xB0, true, 0xA0, N | V}, // 80 - -80 = 160
+		{OP_SBC_IM, 0x50, 0x70, true, 0xE0, N},     // 80 - 112 = -32
+		{OP_SBC_IM, 0xD0, 0x70, true, 0x60, C | V}, // -48 - 112 = -160
+		{OP_SBC_IM, 0xD0, 0x30, true, 0xA0, C | N}, // -48 - 48 = -96
+		{OP_SBC_IM, 0x50, 0x30, true, 0x20, C},     // 80 - 48 = 32
+		{OP_SBC_IM, 0x80, 0x01, true, 0x7F, C | V}, // -128 - 1 = -129
+		{OP_SBC_IM, 0x7F, 0xFF, true, 0x80, N | V}, // 127 - -1 = 128
+		{OP_SBC_IM, 0x05, 0x05, true, 0x00, C | Z}, // 5 - 5 = 0
+
+		// SBC, carry clear (borrow)
+		{OP_SBC_IM, 0x05, 0x05, false, 0xFF, N},     // 5 - 5 - 1 = -1
+		{OP_SBC_IM, 0x00, 0x00, false, 0xFF, N},     // 0 - 0 - 1 = -1
+		{OP_SBC_IM, 0x80, 0x00, false, 0x7F, C | V}, // -128 - 0 - 1 = -129
+		{OP_SBC_IM, 0x7F, 0xFF, false, 0x7F, 0},     // 127 - -1 - 1 = 127
+		{OP_SBC_IM, 0x01, 0x00, false, 0x00, C | Z}, // 1 - 0 - 1 = 0
+		{OP_SBC_IM, 0x81, 0x01, false, 0x7F, C | V}, // -127 - 1 - 1 = -129
+	}
+
+	for _, tc := range tests {
+		rom := PadWithVectors([]byte{tc.op, tc.m}, 0x8000, 0x8000, 0x8000)
+		core, err := NewCore(rom, false, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		core.A = tc.a
+		core.SetFlag(FLAG_CARRY, tc.carryIn)
+		// These should all be overwritten.
+		core.SetFlag(Z|V|N, true)
+
+		if err = core.Step(); err != nil {
+			t.Fatal(err)
+		}
+
+		name := "ADC"
+		if tc.op == OP_SBC_IM {
+			name = "SBC"
+		}
+
+		if core.A != tc.result {
+			t.Errorf("%s $%02X, $%02X, carry %t: Incorrect A: Exp:$%02X Got:$%02X",
+				name, tc.a, tc.m, tc.carryIn, tc.result, core.A)
+		}
+
+		if core.Phlags != tc.flags {
+			t.Errorf("%s $%02X, $%02X, carry %t: Incorrect flags: Exp:%s Got:%s",
+				name, tc.a, tc.m, tc.carryIn, flagsToString(tc.flags), flagsToString(core.Phlags))
+		}
+	}
+}
+
+// Compare sets N from bit 7 of register - operand, not from the operand, and
+// leaves V alone.
+func TestCompareFlags(t *testing.T) {
+	const (
+		C = FLAG_CARRY
+		Z = FLAG_ZERO
+		N = FLAG_NEGATIVE
+	)
+
+	tests := []struct {
+		op    byte
+		reg   uint8
+		m     uint8
+		flags uint8
+	}{
+		{OP_CMP_IM, 0x00, 0x01, N},     // $00 - $01 = $FF
+		{OP_CMP_IM, 0x01, 0xFF, 0},     // $01 - $FF = $02
+		{OP_CMP_IM, 0x80, 0x00, C | N}, // $80 - $00 = $80
+		{OP_CMP_IM, 0xFF, 0x01, C | N}, // $FF - $01 = $FE
+		{OP_CMP_IM, 0x42, 0x42, C | Z},
+		{OP_CMP_IM, 0x90, 0x10, C | N}, // $90 - $10 = $80
+		{OP_CPX_IM, 0x00, 0x01, N},
+		{OP_CPX_IM, 0x05, 0x85, N}, // $05 - $85 = $80, with a borrow
+		{OP_CPY_IM, 0x10, 0x90, N},
+		{OP_CPY_IM, 0xF0, 0x70, C | N},
+		{OP_CPY_IM, 0x70, 0x10, C},
+	}
+
+	for _, tc := range tests {
+		rom := PadWithVectors([]byte{tc.op, tc.m}, 0x8000, 0x8000, 0x8000)
+		core, err := NewCore(rom, false, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var name string
+		switch tc.op {
+		case OP_CMP_IM:
+			name = "CMP"
+			core.A = tc.reg
+		case OP_CPX_IM:
+			name = "CPX"
+			core.X = tc.reg
+		case OP_CPY_IM:
+			name = "CPY"
+			core.Y = tc.reg
+		}
+
+		// Carry is overwritten, overflow is not.
+		core.SetFlag(FLAG_CARRY|FLAG_OVERFLOW, true)
+
+		if err = core.Step(); err != nil {
+			t.Fatal(err)
+		}
+
+		exp := tc.flags | FLAG_OVERFLOW
+		if core.Phlags != exp {
+			t.Errorf("%s $%02X, $%02X: Incorrect flags: Exp:%s Got:%s",
+				name, tc.reg, tc.m, flagsToString(exp), flagsToString(core.Phlags))
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package emu
+
+import (
+	"testing"
+)
+
+// AssertA fails the test if A isn't want.  The failure includes the full
+// register dump.
+func (c *Core) AssertA(t testing.TB, want uint8) {
+	t.Helper()
+	c.assertRegister(t, "A", want, c.A)
+}
+
+// AssertX fails the test if X isn't want.
+func (c *Core) AssertX(t testing.TB, want uint8) {
+	t.Helper()
+	c.assertRegister(t, "X", want, c.X)
+}
+
+// AssertY fails the test if Y isn't want.
+func (c *Core) AssertY(t testing.TB, want uint8) {
+	t.Helper()
+	c.assertRegister(t, "Y", want, c.Y)
+}
+
+// AssertSP fails the test if SP isn't want.
+func (c *Core) AssertSP(t testing.TB, want uint8) {
+	t.Helper()
+	c.assertRegister(t, "SP", want, c.SP)
+}
+
+// AssertPC fails the test if PC isn't want.
+func (c *Core) AssertPC(t testing.TB, want uint16) {
+	t.Helper()
+	if c.PC != want {
+		t.Errorf("Incorrect PC: Exp:$%04X Got:$%04X\n%s", want, c.PC, c.FormatRegisters())
+	}
+}
+
+// AssertFlags fails the test if the status flags aren't exactly want.
+func (c *Core) AssertFlags(t testing.TB, want uint8) {
+	t.Helper()
+	if c.Phlags != want {
+		t.Errorf("Incorrect flags: Exp:%s Got:%s\n%s",
+			flagsToString(want), flagsToString(c.Phlags), c.FormatRegisters())
+	}
+}
+
+func (c *Core) assertRegister(t testing.TB, name string, want, got uint8) {
+	t.Helper()
+	if got != want {
+		t.Errorf("Incorrect %s: Exp:$%02X Got:$%02X\n%s", name, want, got, c.FormatRegisters())
+	}
+}
@@ -0,0 +1,58 @@
+package emu
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// recordingT catches failures so the assertions themselves can be tested.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertions(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_LDA_IM, 0x80, OP_LDX_IM, 0x01, 0xFF}, 0x8000, 0x8000, 0x8000)
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SetTrap(0xFF, haltTrap)
+
+	if err = core.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &recordingT{TB: t}
+	core.AssertA(rec, 0x80)
+	core.AssertX(rec, 0x01)
+	core.AssertY(rec, 0x00)
+	core.AssertSP(rec, 0x00)
+	core.AssertPC(rec, 0x8004)
+	core.AssertFlags(rec, 0x00)
+	if len(rec.errors) != 0 {
+		t.Errorf("Unexpected failures: %v", rec.errors)
+	}
+
+	core.AssertA(rec, 0x81)
+	core.AssertFlags(rec, FLAG_NEGATIVE)
+	if len(rec.errors) != 2 {
+		t.Fatalf("Expected 2 failures, got %d", len(rec.errors))
+	}
+
+	if !strings.HasPrefix(rec.errors[0], "Incorrect A: Exp:$81 Got:$80") {
+		t.Errorf("Incorrect failure message: %q", rec.errors[0])
+	}
+
+	// The register dump is included.
+	if !strings.Contains(rec.errors[1], core.FormatRegisters()) {
+		t.Errorf("Failure is missing the register dump: %q", rec.errors[1])
+	}
+}
@@ -0,0 +1,49 @@
+package emu
+
+import (
+	"fmt"
+)
+
+// validBCD returns true if both nibbles of value are decimal digits.
+func validBCD(value uint8) bool {
+	return value&0x0F <= 0x09 && value>>4 <= 0x09
+}
+
+// checkBCD records an ErrInvalidBCD for tick to return if strict BCD mode is
+// on, the decimal flag is set, and either A or operand isn't valid BCD.
+// The instruction still runs.
+func (c *Core) checkBCD(operand uint8) {
+	if !c.strictBCD || c.Phlags&FLAG_DECIMAL == 0 {
+		return
+	}
+
+	if !validBCD(c.A) || !validBCD(operand) {
+		c.instrErr = fmt.Errorf("%w: [$%04X] A:$%02X operand:$%02X", ErrInvalidBCD, c.PC, c.A, operand)
+	}
+}
+
+// bcdString returns value read as a two digit BCD number, or "--" if it
+// isn't valid BCD.
+func bcdString(value uint8) string {
+	if !validBCD(value) {
+		return "--"
+	}
+	return fmt.Sprintf("%02d", value>>4*10+value&0x0F)
+}
+
+// DumpRegistersBCD prints the registers like DumpRegisters.  If the decimal
+// flag is set, A, X and Y are also shown as BCD values.
+func (c *Core) DumpRegistersBCD() {
+	fmt.Println(c.FormatRegistersBCD())
+}
+
+// FormatRegistersBCD returns the same output as DumpRegistersBCD as a string.
+func (c *Core) FormatRegistersBCD() string {
+	regs := c.registerString()
+	if c.Phlags&FLAG_DECIMAL == 0 {
+		return regs
+	}
+
+	return fmt.Sprintf("%s BCD A: %s X: %s Y: %s",
+		regs, bcdString(c.A), bcdString(c.X), bcdString(c.Y))
+}
@@ -0,0 +1,84 @@
+package emu
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidBCD(t *testing.T) {
+	for _, v := range []uint8{0x00, 0x09, 0x10, 0x45, 0x99} {
+		if !validBCD(v) {
+			t.Errorf("$%02X should be valid BCD", v)
+		}
+	}
+
+	for _, v := range []uint8{0x0A, 0x1F, 0xA0, 0x9A, 0xFF} {
+		if validBCD(v) {
+			t.Errorf("$%02X should not be valid BCD", v)
+		}
+	}
+}
+
+func TestStrictBCD(t *testing.T) {
+	tests := []struct {
+		name    string
+		rom     []byte
+		invalid bool
+	}{
+		{"ADC valid", []byte{OP_SED, OP_LDA_IM, 0x12, OP_ADC_IM, 0x34}, false},
+		{"ADC invalid operand", []byte{OP_SED, OP_LDA_IM, 0x12, OP_ADC_IM, 0x3A}, true},
+		{"ADC invalid A", []byte{OP_SED, OP_LDA_IM, 0xB2, OP_ADC_IM, 0x34}, true},
+		{"SBC invalid operand", []byte{OP_SED, OP_LDA_IM, 0x12, OP_SBC_IM, 0xF0}, true},
+		{"binary mode", []byte{OP_CLD, OP_LDA_IM, 0x12, OP_ADC_IM, 0x3A}, false},
+	}
+
+	for _, tc := range tests {
+		rom := PadWithVectors(append(tc.rom, 0xFF), 0x8000, 0x8000, 0x8000)
+
+		for _, strict := range []bool{false, true} {
+			opts := []Option{}
+			if strict {
+				opts = append(opts, StrictBCD())
+			}
+
+			core, err := NewCore(rom, false, 0, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			core.SetTrap(0xFF, haltTrap)
+
+			err = core.Run()
+			if strict && tc.invalid {
+				if !errors.Is(err, ErrInvalidBCD) {
+					t.Errorf("%s: Expected ErrInvalidBCD, got %v", tc.name, err)
+				}
+
+				// The error stops the run after the instruction.
+				if core.PC != 0x8005 {
+					t.Errorf("%s: Incorrect PC: $%04X", tc.name, core.PC)
+				}
+			} else if err != nil {
+				t.Errorf("%s (strict: %t): Unexpected error: %v", tc.name, strict, err)
+			}
+		}
+	}
+}
+
+func TestFormatRegistersBCD(t *testing.T) {
+	core := newTestCore(t)
+	core.A = 0x42
+	core.X = 0x09
+	core.Y = 0x3C
+	core.SP = 0xFD
+	core.Phlags = 0
+
+	if got := core.FormatRegistersBCD(); got != core.FormatRegisters() {
+		t.Errorf("BCD values shown with decimal flag clear: %q", got)
+	}
+
+	core.Phlags = FLAG_DECIMAL
+	exp := core.FormatRegisters() + " BCD A: 42 X: 09 Y: --"
+	if got := core.FormatRegistersBCD(); got != exp {
+		t.Errorf("Incorrect FormatRegistersBCD():\nExp:%q\nGot:%q", exp, got)
+	}
+}
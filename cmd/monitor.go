@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/zorchenhimer/emu-6502"
+)
+
+const monitorHelp = `Commands:
+  s         step one instruction
+  r         dump registers
+  m addr    dump 16 bytes of memory starting at addr
+  b addr    toggle a breakpoint at addr
+  c         continue until a breakpoint or error
+  q         quit`
+
+// monitor runs a simple command loop reading from in until it's closed or
+// the user quits.
+func monitor(core *emu.Core, in io.Reader, out io.Writer) {
+	breakpoints := map[uint16]bool{}
+	scanner := bufio.NewScanner(in)
+
+	showNext(core, out)
+	fmt.Fprint(out, "> ")
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			fmt.Fprint(out, "> ")
+			continue
+		}
+
+		switch fields[0] {
+		case "s":
+			if err := core.Step(); err != nil {
+				fmt.Fprintln(out, err)
+			}
+			showNext(core, out)
+
+		case "r":
+			fmt.Fprintln(out, core.FormatRegisters())
+
+		case "m":
+			addr, err := parseAddr(fields)
+			if err != nil {
+				fmt.Fprintln(out, err)
+				break
+			}
+
+			vals := []string{}
+			for i := uint16(0); i < 16; i++ {
+				vals = append(vals, fmt.Sprintf("%02X", core.PeekByte(addr+i)))
+			}
+			fmt.Fprintf(out, "%04X: %s\n", addr, strings.Join(vals, " "))
+
+		case "b":
+			addr, err := parseAddr(fields)
+			if err != nil {
+				fmt.Fprintln(out, err)
+				break
+			}
+
+			if breakpoints[addr] {
+				delete(breakpoints, addr)
+				fmt.Fprintf(out, "Breakpoint at $%04X removed\n", addr)
+			} else {
+				breakpoints[addr] = true
+				fmt.Fprintf(out, "Breakpoint at $%04X set\n", addr)
+			}
+
+		case "c":
+			for {
+				if err := core.Step(); err != nil {
+					fmt.Fprintln(out, err)
+					break
+				}
+
+				if breakpoints[core.PC] {
+					fmt.Fprintf(out, "Breakpoint at $%04X\n", core.PC)
+					break
+				}
+			}
+			showNext(core, out)
+
+		case "q":
+			return
+
+		default:
+			fmt.Fprintln(out, monitorHelp)
+		}
+
+		fmt.Fprint(out, "> ")
+	}
+}
+
+func showNext(core *emu.Core, out io.Writer) {
+	asm, _ := core.Disassemble(core.PC)
+	fmt.Fprintf(out, "$%04X: %s\n", core.PC, asm)
+}
+
+func parseAddr(fields []string) (uint16, error) {
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("Missing address")
+	}
+
+	addr, err := strconv.ParseUint(strings.TrimPrefix(fields[1], "$"), 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid address: %q", fields[1])
+	}
+	return uint16(addr), nil
+}
@@ -1,26 +1,25 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/zorchenhimer/emu-6502"
 )
 
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Missing rom")
-		return
-	}
+	interactive := flag.Bool("interactive", false, "Step through the ROM with a simple monitor")
+	flag.Parse()
 
-	rom, err := ioutil.ReadFile(os.Args[1])
-	if err != nil {
-		fmt.Println(err)
+	if flag.NArg() != 1 {
+		fmt.Println("Missing rom")
 		return
 	}
 
-	core, err := emu.NewRWCore(rom, 0)
+	// vectors have traps
+	core, err := loadCore(flag.Arg(0))
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -34,11 +33,13 @@ func main() {
 	defer file.Close()
 
 	core.DebugFile = file
-	// vectors have traps
-	core.PC = 0x8000
-	//core.PC = 0x0400
 	core.Debug = true
 
+	if *interactive {
+		monitor(core, os.Stdin, os.Stdout)
+		return
+	}
+
 	err = core.Run()
 	if err != nil {
 		fmt.Println(err)
@@ -50,3 +51,27 @@ func main() {
 		return
 	}
 }
+
+// loadCore creates a core from a raw 64k binary or an Intel HEX file.  HEX
+// files start at their entry point if they have one.
+func loadCore(path string) (*emu.Core, error) {
+	if !strings.HasSuffix(strings.ToLower(path), ".hex") {
+		return emu.NewRWCoreFromFile(path, 0, emu.StartPC(0x8000))
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	image, entry, err := emu.LoadIntelHex(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == 0 {
+		entry = 0x8000
+	}
+	return emu.NewRWCore(image, 0, emu.StartPC(entry))
+}
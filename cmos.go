@@ -0,0 +1,360 @@
+package emu
+
+import (
+	"fmt"
+)
+
+// 65C02 opcodes.  These are decoded by the 65C02 and Rockwell variants, and
+// take priority over the NMOS tables.
+var cmosInstructionList = [256]Instruction{
+
+	OP_ADC_IZ: StandardInstruction{
+		OpCode:         OP_ADC_IZ,
+		Instruction:    "ADC",
+		AddressMode: ADDR_IndirectZP,
+		Exec:           instr_ADC},
+	OP_AND_IZ: StandardInstruction{
+		OpCode:         OP_AND_IZ,
+		Instruction:    "AND",
+		AddressMode: ADDR_IndirectZP,
+		Exec:           instr_AND},
+	OP_CMP_IZ: StandardInstruction{
+		OpCode:         OP_CMP_IZ,
+		Instruction:    "CMP",
+		AddressMode: ADDR_IndirectZP,
+		Exec:           instr_CMP},
+	OP_EOR_IZ: StandardInstruction{
+		OpCode:         OP_EOR_IZ,
+		Instruction:    "EOR",
+		AddressMode: ADDR_IndirectZP,
+		Exec:           instr_EOR},
+	OP_LDA_IZ: StandardInstruction{
+		OpCode:         OP_LDA_IZ,
+		Instruction:    "LDA",
+		AddressMode: ADDR_IndirectZP,
+		Exec:           instr_LDA},
+	OP_ORA_IZ: StandardInstruction{
+		OpCode:         OP_ORA_IZ,
+		Instruction:    "ORA",
+		AddressMode: ADDR_IndirectZP,
+		Exec:           instr_ORA},
+	OP_SBC_IZ: StandardInstruction{
+		OpCode:         OP_SBC_IZ,
+		Instruction:    "SBC",
+		AddressMode: ADDR_IndirectZP,
+		Exec:           instr_SBC},
+	OP_STA_IZ: StandardInstruction{
+		OpCode:         OP_STA_IZ,
+		Instruction:    "STA",
+		AddressMode: ADDR_IndirectZP,
+		Exec:           instr_STA},
+
+	OP_JMP_AX: Jump{
+		OpCode: OP_JMP_AX,
+		Instruction: "JMP",
+		AddressMode: ADDR_AbsoluteIndirectX,
+		Exec: instr_JMP},
+}
+
+// Base cycle counts for 65C02 opcodes that differ from opcodeCycles.  Zero
+// means the NMOS count is used.
+var cmosCycles = [256]uint8{
+	OP_ORA_IZ: 5,
+	OP_AND_IZ: 5,
+	OP_EOR_IZ: 5,
+	OP_ADC_IZ: 5,
+	OP_STA_IZ: 5,
+	OP_LDA_IZ: 5,
+	OP_CMP_IZ: 5,
+	OP_SBC_IZ: 5,
+
+	OP_JMP_ID: 6, // one more than NMOS to fix the page wrap
+	OP_JMP_AX: 6,
+}
+
+// Rockwell bit instructions.  These are decoded by the Rockwell and WDC
+// variants.
+var rockwellInstructionList = [256]Instruction{
+
+	OP_RMB0: StandardInstruction{
+		OpCode:         OP_RMB0,
+		Instruction:    "RMB0",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_RMB(0)},
+	OP_RMB1: StandardInstruction{
+		OpCode:         OP_RMB1,
+		Instruction:    "RMB1",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_RMB(1)},
+	OP_RMB2: StandardInstruction{
+		OpCode:         OP_RMB2,
+		Instruction:    "RMB2",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_RMB(2)},
+	OP_RMB3: StandardInstruction{
+		OpCode:         OP_RMB3,
+		Instruction:    "RMB3",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_RMB(3)},
+	OP_RMB4: StandardInstruction{
+		OpCode:         OP_RMB4,
+		Instruction:    "RMB4",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_RMB(4)},
+	OP_RMB5: StandardInstruction{
+		OpCode:         OP_RMB5,
+		Instruction:    "RMB5",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_RMB(5)},
+	OP_RMB6: StandardInstruction{
+		OpCode:         OP_RMB6,
+		Instruction:    "RMB6",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_RMB(6)},
+	OP_RMB7: StandardInstruction{
+		OpCode:         OP_RMB7,
+		Instruction:    "RMB7",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_RMB(7)},
+	OP_SMB0: StandardInstruction{
+		OpCode:         OP_SMB0,
+		Instruction:    "SMB0",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_SMB(0)},
+	OP_SMB1: StandardInstruction{
+		OpCode:         OP_SMB1,
+		Instruction:    "SMB1",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_SMB(1)},
+	OP_SMB2: StandardInstruction{
+		OpCode:         OP_SMB2,
+		Instruction:    "SMB2",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_SMB(2)},
+	OP_SMB3: StandardInstruction{
+		OpCode:         OP_SMB3,
+		Instruction:    "SMB3",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_SMB(3)},
+	OP_SMB4: StandardInstruction{
+		OpCode:         OP_SMB4,
+		Instruction:    "SMB4",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_SMB(4)},
+	OP_SMB5: StandardInstruction{
+		OpCode:         OP_SMB5,
+		Instruction:    "SMB5",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_SMB(5)},
+	OP_SMB6: StandardInstruction{
+		OpCode:         OP_SMB6,
+		Instruction:    "SMB6",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_SMB(6)},
+	OP_SMB7: StandardInstruction{
+		OpCode:         OP_SMB7,
+		Instruction:    "SMB7",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_SMB(7)},
+	OP_BBR0: BitBranch{
+		OpCode:      OP_BBR0,
+		Instruction: "BBR0",
+		Bit:         0,
+		Set:         false},
+	OP_BBR1: BitBranch{
+		OpCode:      OP_BBR1,
+		Instruction: "BBR1",
+		Bit:         1,
+		Set:         false},
+	OP_BBR2: BitBranch{
+		OpCode:      OP_BBR2,
+		Instruction: "BBR2",
+		Bit:         2,
+		Set:         false},
+	OP_BBR3: BitBranch{
+		OpCode:      OP_BBR3,
+		Instruction: "BBR3",
+		Bit:         3,
+		Set:         false},
+	OP_BBR4: BitBranch{
+		OpCode:      OP_BBR4,
+		Instruction: "BBR4",
+		Bit:         4,
+		Set:         false},
+	OP_BBR5: BitBranch{
+		OpCode:      OP_BBR5,
+		Instruction: "BBR5",
+		Bit:         5,
+		Set:         false},
+	OP_BBR6: BitBranch{
+		OpCode:      OP_BBR6,
+		Instruction: "BBR6",
+		Bit:         6,
+		Set:         false},
+	OP_BBR7: BitBranch{
+		OpCode:      OP_BBR7,
+		Instruction: "BBR7",
+		Bit:         7,
+		Set:         false},
+	OP_BBS0: BitBranch{
+		OpCode:      OP_BBS0,
+		Instruction: "BBS0",
+		Bit:         0,
+		Set:         true},
+	OP_BBS1: BitBranch{
+		OpCode:      OP_BBS1,
+		Instruction: "BBS1",
+		Bit:         1,
+		Set:         true},
+	OP_BBS2: BitBranch{
+		OpCode:      OP_BBS2,
+		Instruction: "BBS2",
+		Bit:         2,
+		Set:         true},
+	OP_BBS3: BitBranch{
+		OpCode:      OP_BBS3,
+		Instruction: "BBS3",
+		Bit:         3,
+		Set:         true},
+	OP_BBS4: BitBranch{
+		OpCode:      OP_BBS4,
+		Instruction: "BBS4",
+		Bit:         4,
+		Set:         true},
+	OP_BBS5: BitBranch{
+		OpCode:      OP_BBS5,
+		Instruction: "BBS5",
+		Bit:         5,
+		Set:         true},
+	OP_BBS6: BitBranch{
+		OpCode:      OP_BBS6,
+		Instruction: "BBS6",
+		Bit:         6,
+		Set:         true},
+	OP_BBS7: BitBranch{
+		OpCode:      OP_BBS7,
+		Instruction: "BBS7",
+		Bit:         7,
+		Set:         true},
+}
+
+// Base cycle counts for the Rockwell bit instructions.  Taken branches add
+// the same penalty as the other branches; see BitBranch.Cycles.
+var rockwellCycles = [256]uint8{
+	OP_RMB0: 5, OP_RMB1: 5, OP_RMB2: 5, OP_RMB3: 5, OP_RMB4: 5, OP_RMB5: 5, OP_RMB6: 5, OP_RMB7: 5,
+	OP_SMB0: 5, OP_SMB1: 5, OP_SMB2: 5, OP_SMB3: 5, OP_SMB4: 5, OP_SMB5: 5, OP_SMB6: 5, OP_SMB7: 5,
+	OP_BBR0: 5, OP_BBR1: 5, OP_BBR2: 5, OP_BBR3: 5, OP_BBR4: 5, OP_BBR5: 5, OP_BBR6: 5, OP_BBR7: 5,
+	OP_BBS0: 5, OP_BBS1: 5, OP_BBS2: 5, OP_BBS3: 5, OP_BBS4: 5, OP_BBS5: 5, OP_BBS6: 5, OP_BBS7: 5,
+}
+
+// WDC additions.  These are only decoded by the WDC variant, which also has
+// the Rockwell bit instructions.
+var wdcInstructionList = [256]Instruction{
+
+	OP_WAI: StandardInstruction{
+		OpCode:         OP_WAI,
+		Instruction:    "WAI",
+		AddressMode: ADDR_Implied,
+		Exec:           instr_WAI},
+	OP_STP: StandardInstruction{
+		OpCode:         OP_STP,
+		Instruction:    "STP",
+		AddressMode: ADDR_Implied,
+		Exec:           instr_STP},
+}
+
+// Base cycle counts for the WDC additions.
+var wdcCycles = [256]uint8{
+	OP_WAI: 3,
+	OP_STP: 3,
+}
+
+// hasBitInstructions reports whether the core's variant decodes the
+// Rockwell bit instructions.
+func (c *Core) hasBitInstructions() bool {
+	return c.variant == VariantRockwell || c.variant == VariantWDC
+}
+
+// variantInstruction returns the instruction opcode decodes to on the core's
+// variant, or nil if it isn't different from the NMOS tables.
+func (c *Core) variantInstruction(opcode byte) Instruction {
+	if c.variant == VariantWDC && wdcInstructionList[opcode] != nil {
+		return wdcInstructionList[opcode]
+	}
+	if c.hasBitInstructions() && rockwellInstructionList[opcode] != nil {
+		return rockwellInstructionList[opcode]
+	}
+	if c.variant != VariantNMOS {
+		return cmosInstructionList[opcode]
+	}
+	return nil
+}
+
+// WAI stops executing until an interrupt.  The run returns ErrWaiting so the
+// caller can raise one with IRQ, NMI, or RaiseNMI.
+func instr_WAI(c *Core, address uint16) {
+	c.waiting = true
+	c.instrErr = fmt.Errorf("%w at $%04X", ErrWaiting, c.PC)
+}
+
+// STP stops the clock.  Only Reset starts it again.
+func instr_STP(c *Core, address uint16) {
+	c.stopped = true
+	c.instrErr = fmt.Errorf("%w at $%04X", ErrStopped, c.PC)
+}
+
+// instr_RMB returns an Exec that clears bit in a zero page byte.
+func instr_RMB(bit uint8) ExecFunc {
+	return func(c *Core, address uint16) {
+		c.WriteByte(address, c.ReadByte(address)&^(1<<bit))
+	}
+}
+
+// instr_SMB returns an Exec that sets bit in a zero page byte.
+func instr_SMB(bit uint8) ExecFunc {
+	return func(c *Core, address uint16) {
+		c.WriteByte(address, c.ReadByte(address)|(1<<bit))
+	}
+}
+
+// BitBranch is the Rockwell BBR and BBS, which branch if a bit in a zero page
+// byte is clear or set.
+type BitBranch struct {
+	OpCode      byte
+	Instruction string
+	Bit         uint8
+	Set         bool
+}
+
+func (b BitBranch) AddressMeta() AddressModeMeta {
+	return ADDR_ZeroPageRelative
+}
+
+func (b BitBranch) Name() string {
+	return b.Instruction
+}
+
+func (b BitBranch) taken(value uint8) bool {
+	return (value&(1<<b.Bit) != 0) == b.Set
+}
+
+func (b BitBranch) Execute(c *Core) {
+	value := c.ReadByte(uint16(c.ReadByte(c.PC + 1)))
+	if b.taken(value) {
+		c.PC = c.addrRelative(c.PC+1, c.ReadByte(c.PC+2))
+	} else {
+		c.PC += 3
+	}
+}
+
+func (b BitBranch) InstrLength(c *Core) uint8 {
+	return 3
+}
+
+func (b BitBranch) Cycles(c *Core) uint8 {
+	cycles := c.baseCycles(c.PeekByte(c.PC))
+	if b.taken(c.PeekByte(uint16(c.PeekByte(c.PC + 1)))) {
+		cycles += branchPenalty(c.PC+3, c.addrRelative(c.PC+1, c.PeekByte(c.PC+2)))
+	}
+	return cycles
+}
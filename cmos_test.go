@@ -0,0 +1,337 @@
+package emu
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIndirectZeroPage(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_IZ, 0x40,
+		OP_LDX_IM, 0x00,
+		OP_ORA_IZ, 0xFF, // pointer wraps to $00
+		OP_STA_IZ, 0x42,
+		0xFF,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0, CPUVariant(Variant65C02))
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SetTrap(0xFF, haltTrap)
+
+	core.memory[0x40] = 0x00 // $0300
+	core.memory[0x41] = 0x03
+	core.memory[0x42] = 0x20 // $0420
+	core.memory[0x43] = 0x04
+	core.memory[0xFF] = 0x10 // $0310
+	core.memory[0x00] = 0x03
+	core.memory[0x0300] = 0x5A
+	core.memory[0x0310] = 0x81
+
+	if err = core.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.A != 0xDB {
+		t.Errorf("Incorrect A: Exp:$DB Got:$%02X", core.A)
+	}
+
+	if core.memory[0x0420] != 0xDB {
+		t.Errorf("Incorrect memory value at $0420: Exp:$DB Got:$%02X", core.memory[0x0420])
+	}
+
+	if core.Cycles() != 17 {
+		t.Errorf("Incorrect cycle count: Exp:17 Got:%d", core.Cycles())
+	}
+
+	asm, l := core.Disassemble(0x8000)
+	if asm != "LDA ($40) @ $0300" || l != 2 {
+		t.Errorf("Incorrect disassembly: %q length %d", asm, l)
+	}
+}
+
+func TestIndirectZeroPageNMOS(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_LDA_IZ, 0x40}, 0x8000, 0x8000, 0x8000)
+
+	// On an NMOS part this is a KIL opcode.
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = core.Step(); !errors.Is(err, ErrJammed) {
+		t.Errorf("Expected ErrJammed, got %v", err)
+	}
+}
+
+func TestRockwellBitInstructions(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_SMB3, 0x10, // $8000
+		OP_RMB0, 0x10, // $8002
+		OP_BBS3, 0x10, 0x02, // $8004, taken
+		OP_LDX_IM, 0x01, // $8007, skipped
+		OP_BBS4, 0x10, 0x02, // $8009, not taken
+		OP_LDY_IM, 0x02, // $800C
+		OP_BBR4, 0x10, 0x02, // $800E, taken
+		OP_LDA_IM, 0x03, // $8011, skipped
+		0xFF, // $8013
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0, CPUVariant(VariantRockwell))
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SetTrap(0xFF, haltTrap)
+	core.memory[0x10] = 0x01
+
+	if err = core.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.memory[0x10] != 0x08 {
+		t.Errorf("Incorrect memory value: Exp:$08 Got:$%02X", core.memory[0x10])
+	}
+
+	exp := Registers{A: 0x00, X: 0x00, Y: 0x02, PC: 0x8013}
+	if core.Registers() != exp {
+		t.Errorf("Incorrect registers:\nExp:%+v\nGot:%+v", exp, core.Registers())
+	}
+
+	asm, l := core.Disassemble(0x8004)
+	if asm != "BBS3 $10, $8009" || l != 3 {
+		t.Errorf("Incorrect disassembly: %q length %d", asm, l)
+	}
+
+	// The plain 65C02 doesn't have the bit instructions.
+	core, err = NewCore(rom, false, 0, CPUVariant(Variant65C02))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = core.Step(); !errors.Is(err, ErrUnimplementedOpcode) {
+		t.Errorf("Expected ErrUnimplementedOpcode, got %v", err)
+	}
+}
+
+// The NMOS 6502 doesn't carry into the high byte of a JMP (Indirect) pointer
+// at $xxFF.  The 65C02 does.
+func TestJumpIndirectPageBoundary(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_JMP_ID, 0xFF, 0x02}, 0x8000, 0x8000, 0x8000)
+
+	tests := []struct {
+		variant Variant
+		pc      uint16
+		cycles  uint64
+	}{
+		{VariantNMOS, 0x9010, 5},
+		{Variant65C02, 0x8010, 6},
+	}
+
+	for _, tc := range tests {
+		core, err := NewCore(rom, false, 0, CPUVariant(tc.variant))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		core.memory[0x02FF] = 0x10
+		core.memory[0x0300] = 0x80
+		core.memory[0x0200] = 0x90
+
+		if err = core.Step(); err != nil {
+			t.Fatal(err)
+		}
+
+		if core.PC != tc.pc {
+			t.Errorf("Variant %d: Incorrect PC: Exp:$%04X Got:$%04X", tc.variant, tc.pc, core.PC)
+		}
+
+		if core.Cycles() != tc.cycles {
+			t.Errorf("Variant %d: Incorrect cycles: Exp:%d Got:%d", tc.variant, tc.cycles, core.Cycles())
+		}
+	}
+}
+
+func TestJumpAbsoluteIndirectX(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDX_IM, 0x02,
+		OP_JMP_AX, 0x00, 0x04,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0, CPUVariant(Variant65C02))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	core.memory[0x0400] = 0x11
+	core.memory[0x0401] = 0x11
+	core.memory[0x0402] = 0x20
+	core.memory[0x0403] = 0x80
+
+	if err = core.Step(); err != nil {
+		t.Fatal(err)
+	}
+
+	asm, l := core.Disassemble(0x8002)
+	if asm != "JMP ($0400, X) @ $8020" || l != 3 {
+		t.Errorf("Incorrect disassembly: %q length %d", asm, l)
+	}
+
+	if err = core.Step(); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.PC != 0x8020 {
+		t.Errorf("Incorrect PC: Exp:$8020 Got:$%04X", core.PC)
+	}
+
+	if core.Cycles() != 8 {
+		t.Errorf("Incorrect cycles: Exp:8 Got:%d", core.Cycles())
+	}
+
+	// Not an instruction on NMOS.
+	core, err = NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	core.Step()
+	if err = core.Step(); !errors.Is(err, ErrUnimplementedOpcode) {
+		t.Errorf("Expected ErrUnimplementedOpcode on NMOS, got %v", err)
+	}
+}
+
+func TestWAI(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_WAI,          // $8000
+		OP_LDX_IM, 0x01, // $8001
+		0xFF,            // $8003
+		OP_LDA_IM, 0x42, // $8004, interrupt handler
+		OP_RTI,
+	}, 0x8004, 0x8000, 0x8004)
+
+	for _, masked := range []bool{false, true} {
+		core, err := NewCore(rom, false, 0, CPUVariant(VariantWDC))
+		if err != nil {
+			t.Fatal(err)
+		}
+		core.SetTrap(0xFF, haltTrap)
+		core.SP = 0xFD
+		if masked {
+			core.Phlags = FLAG_INTERRUPT
+		}
+
+		if err = core.Run(); !errors.Is(err, ErrWaiting) {
+			t.Fatalf("masked %t: Expected ErrWaiting, got %v", masked, err)
+		}
+
+		// Still waiting until an interrupt comes in.
+		if err = core.Step(); !errors.Is(err, ErrWaiting) {
+			t.Fatalf("masked %t: Expected ErrWaiting, got %v", masked, err)
+		}
+
+		if core.PC != 0x8001 {
+			t.Errorf("masked %t: Incorrect PC: Exp:$8001 Got:$%04X", masked, core.PC)
+		}
+
+		if core.IRQ() == masked {
+			t.Errorf("masked %t: Incorrect IRQ result", masked)
+		}
+
+		if err = core.Run(); err != nil {
+			t.Fatalf("masked %t: %v", masked, err)
+		}
+
+		// A masked IRQ ends the wait without running the handler.
+		expA := uint8(0x42)
+		if masked {
+			expA = 0x00
+		}
+
+		if core.A != expA || core.X != 0x01 {
+			t.Errorf("masked %t: Incorrect registers: Exp:A:$%02X X:$01 Got:A:$%02X X:$%02X",
+				masked, expA, core.A, core.X)
+		}
+	}
+
+	// RaiseNMI ends the wait at the next instruction.
+	core, err := NewCore(rom, false, 0, CPUVariant(VariantWDC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SetTrap(0xFF, haltTrap)
+	core.SP = 0xFD
+
+	if err = core.Run(); !errors.Is(err, ErrWaiting) {
+		t.Fatalf("Expected ErrWaiting, got %v", err)
+	}
+
+	core.RaiseNMI()
+	if err = core.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.A != 0x42 || core.X != 0x01 {
+		t.Errorf("Incorrect registers after NMI: A:$%02X X:$%02X", core.A, core.X)
+	}
+}
+
+func TestSTP(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDX_IM, 0x01, // $8000, reset
+		0xFF, // $8002
+		OP_NOP,
+		OP_STP,          // $8004, start
+		OP_LDY_IM, 0x02, // $8005, never reached
+		OP_RTI, // $8007, interrupt handler
+	}, 0x8007, 0x8000, 0x8007)
+
+	core, err := NewCore(rom, false, 0, CPUVariant(VariantWDC), StartPC(0x8004))
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SetTrap(0xFF, haltTrap)
+	core.SP = 0xFD
+
+	if err = core.Run(); !errors.Is(err, ErrStopped) {
+		t.Fatalf("Expected ErrStopped, got %v", err)
+	}
+
+	// Interrupts don't restart the clock.
+	if core.IRQ() {
+		t.Errorf("IRQ serviced while stopped")
+	}
+	core.NMI()
+	core.RaiseNMI()
+
+	if err = core.Step(); !errors.Is(err, ErrStopped) {
+		t.Fatalf("Expected ErrStopped, got %v", err)
+	}
+
+	if core.PC != 0x8005 || core.SP != 0xFD {
+		t.Errorf("Interrupt taken while stopped: PC:$%04X SP:$%02X", core.PC, core.SP)
+	}
+
+	core.Reset()
+	if core.PC != 0x8000 || core.SP != 0xFA || !core.Interrupt() {
+		t.Errorf("Incorrect state after reset: PC:$%04X SP:$%02X P:$%02X", core.PC, core.SP, core.Phlags)
+	}
+
+	if err = core.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.X != 0x01 || core.Y != 0x00 {
+		t.Errorf("Incorrect registers: Exp:X:$01 Y:$00 Got:X:$%02X Y:$%02X", core.X, core.Y)
+	}
+
+	// WAI and STP are WDC only.
+	core, err = NewCore(rom, false, 0, CPUVariant(Variant65C02), StartPC(0x8004))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = core.Step(); !errors.Is(err, ErrUnimplementedOpcode) {
+		t.Errorf("Expected ErrUnimplementedOpcode, got %v", err)
+	}
+}
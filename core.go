@@ -1,6 +1,7 @@
 package emu
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"io"
@@ -17,6 +18,82 @@ const (
 	VECTOR_IRQ   uint16 = 0xFFFE
 )
 
+var (
+	// ErrJammed is returned when the CPU executes one of the undocumented
+	// KIL opcodes that lock up an NMOS 6502.
+	ErrJammed = errors.New("CPU jammed")
+
+	// ErrStuck is returned when the stuck detector sees the PC stop moving.
+	ErrStuck = errors.New("Stuck")
+
+	// ErrInstructionLimit is returned when a run executes its maximum
+	// number of instructions without finishing.
+	ErrInstructionLimit = errors.New("Instruction limit hit")
+
+	// ErrBadResetVector is returned by the constructor when reset vector
+	// validation is enabled and the vector doesn't point into ROM.
+	ErrBadResetVector = errors.New("Reset vector does not point to ROM")
+
+	// ErrLoadOverflow is returned by LoadBytes when the data doesn't fit
+	// below $FFFF.
+	ErrLoadOverflow = errors.New("Data runs past the end of memory")
+
+	// ErrInvalidBCD is returned in strict BCD mode when ADC or SBC runs in
+	// decimal mode with a value that isn't valid BCD.
+	ErrInvalidBCD = errors.New("Invalid BCD value")
+
+	// ErrROMWrite is returned when a program writes to ROM and the ROM
+	// write policy is ROMWriteError.
+	ErrROMWrite = errors.New("Write to ROM")
+
+	// ErrWaiting is returned while a WDC 65C02 is waiting for an interrupt
+	// after WAI.
+	ErrWaiting = errors.New("Waiting for interrupt")
+
+	// ErrStopped is returned while a WDC 65C02 is stopped by STP, until
+	// Reset.
+	ErrStopped = errors.New("CPU stopped")
+
+	// ErrPanic is returned when the emulator panics while executing an
+	// instruction.
+	ErrPanic = errors.New("Panic")
+
+	// ErrUnimplementedOpcode is matched by UnimplementedOpcodeError.
+	ErrUnimplementedOpcode = errors.New("OP Code not implemented")
+)
+
+// UnimplementedOpcodeError is returned when an opcode without a decoded
+// instruction is executed.  It matches ErrUnimplementedOpcode with errors.Is.
+type UnimplementedOpcodeError struct {
+	Opcode byte
+	PC     uint16
+}
+
+func (e UnimplementedOpcodeError) Error() string {
+	return fmt.Sprintf("%s: [$%04X] $%02X", ErrUnimplementedOpcode, e.PC, e.Opcode)
+}
+
+func (e UnimplementedOpcodeError) Unwrap() error {
+	return ErrUnimplementedOpcode
+}
+
+// Undocumented opcodes that halt the processor until a reset.
+var jamOpcodes = map[byte]bool{
+	0x02: true, 0x12: true, 0x22: true, 0x32: true,
+	0x42: true, 0x52: true, 0x62: true, 0x72: true,
+	0x92: true, 0xB2: true, 0xD2: true, 0xF2: true,
+}
+
+// OpenBusMode selects what is returned when reading an unmapped address.
+type OpenBusMode int
+
+const (
+	OpenBusZero     OpenBusMode = iota // always read zero
+	OpenBusConstant                    // always read Core.OpenBusValue
+	OpenBusLastRead                    // repeat the last value read from mapped memory
+	OpenBusHighByte                    // high byte of the address, like the last operand byte of an absolute read
+)
+
 type Core struct {
 	// Main registers
 	A uint8
@@ -30,33 +107,179 @@ type Core struct {
 
 	memory []byte // Slice of loaded memory.  This is only main RAM.
 	rom    []byte // ROM image.  Needs to be a multiple of 256.
-	wram   []byte
+	wram   []byte // all WRAM banks
+	wramBank int  // bank mapped to $6000-$7FFF
+	romOffset int // added to ROM addresses by SetROMBank
 
-	InstructionLimit uint64 // number of instructions to run
+	InstructionLimit uint64 // Run stops with ErrInstructionLimit after this many, zero is unlimited
 	testing          bool
-	testDone         bool
+	halted           bool // a trap stopped the run
 	t                *testing.T
 	ticks            uint64
+	cycles           uint64
 
 	fullRW bool
 
 	lastPC   uint16
 	lastSame int
 	lastReadAddr uint16
-	checkStuck bool
+	lastWriteAddr uint16
+	readRegister bool // last instruction read a memory-mapped register
+
+	// Number of times the same instruction can be executed back to back
+	// before the run is considered stuck.  Instructions that read a
+	// memory-mapped register are assumed to be polling and never count
+	// towards this.  Zero disables the check.
+	StuckThreshold uint
+
+	// Called when the stuck detector fires, with the PC and the number of
+	// times it repeated.  Returning true resets the count and continues the
+	// run; returning false stops it with ErrStuck.
+	StuckHook func(c *Core, pc uint16, count int) bool
+
+	// Value returned for reads from unmapped addresses.  OpenBusValue is
+	// only used with OpenBusConstant.
+	OpenBus      OpenBusMode
+	OpenBusValue uint8
+	lastBusValue uint8
+
+	jammed bool
+	jamPC  uint16
+
+	waiting bool // WAI until an interrupt
+	stopped bool // STP until a reset
+
+	traps map[byte]func(c *Core) bool
+
+	// Opcode that halts the core instead of executing, once enabled with
+	// the HaltOn option.  Test cores use $FF, which is also the
+	// undocumented ISC Absolute,X, so tests using illegal opcodes can pick
+	// another byte.
+	HaltOpcode uint8
+	haltOn     bool // stop on HaltOpcode
+
+	// Execute opcodes with no implementation as one-byte, two-cycle NOPs
+	// instead of returning UnimplementedOpcodeError.  Each one is logged to
+	// DebugFile, or stdout without one.  NMOS jam opcodes still return
+	// ErrJammed.  Useful to see how far a ROM gets during bring-up.
+	TreatUnknownAsNop bool
+
+	allowIllegal bool // decode undocumented opcodes
+	variant      Variant
+
+	// Per-core instruction overrides, checked before instructionList.  Nil
+	// until an instruction is overridden.
+	instructions map[byte]Instruction
+
+	validateReset bool
+	ramPattern    RAMPattern
+	ramSeed       int64 // source for RAMRandom
+	strictBCD     bool
+	dummyReads    bool
+	dummyWrites   bool
+	romWrites     ROMWritePolicy
+	instrErr      error // raised by the current instruction, returned by tick
+	strictROM     bool   // reject ROMs that aren't a multiple of 256 bytes
+	romFill       uint8  // pads the last page of a short ROM
+	startPC       uint16 // used instead of the reset vector if hasStartPC
+	hasStartPC    bool
+
+	callDepth int // subroutine and interrupt nesting depth
+
+	nmiPending bool // raised NMI waiting for the next instruction boundary
+
+	// Called when the stack pointer wraps around, with overflow set for a
+	// push past $0100 and cleared for a pull past $01FF.  The hardware
+	// wraps silently; this is a debugging aid for runaway recursion.
+	StackGuard func(c *Core, overflow bool)
+
+	// Called for every byte pushed or pulled, including return addresses
+	// and interrupt state, with the stack pointer after the operation.
+	StackHook func(c *Core, push bool, value uint8, sp uint8)
+
+	// Called for each flag changed by an instruction or interrupt, with the
+	// address of the instruction, or the return address of the interrupt.
+	// Flags are compared before and after, so a flag that is set and
+	// cleared again isn't reported.
+	FlagHook func(c *Core, pc uint16, flag uint8, oldValue, newValue bool)
+
+	// Called once for each cycle an instruction or interrupt takes, with
+	// the total cycle count including that cycle.  Cycles are counted from
+	// the instruction's cycle count before it executes, so this is only an
+	// approximation of cycle stepping, but it lets external hardware keep
+	// pace with the CPU.
+	PerCycleHook func(cycle uint64)
+
+	readHandlers  []readMapping
+	writeHandlers []writeMapping
+
+	romSegments []ROMSegment // added with MapROM, nil until one is mapped
+
+	coverage []bool // executed instruction bytes, nil when not tracking
+
+	opcodeCounts map[byte]uint64 // executions per opcode, nil when not counting
+
+	rewind    []CoreState // ring buffer of states for StepBack
+	rewindIdx int
+	rewindLen int
+
+	accessLog []MemAccess // ring buffer of memory accesses, nil when not logging
+	accessIdx int
+	accessLen int
 
 	// VERY verbose output
 	Debug bool
 	DebugFile io.Writer
+	TraceFormat TraceFormat // format of the lines written to DebugFile
+	TraceLevel  TraceLevel  // detail in each text trace line
+	TraceFlags  bool        // also write flag changes to DebugFile
 
 	history [HistoryLength]string
 	historyIdx int
 }
 
-func NewRWCore(rom []byte, instrLimit uint64) (*Core, error) {
-	if len(rom) != 0x10000 {
-		return nil, fmt.Errorf("ROM must be exactly 64k (%X)", len(rom))
+// Registers is a snapshot of the CPU registers.
+type Registers struct {
+	A      uint8
+	X      uint8
+	Y      uint8
+	PC     uint16
+	Phlags uint8
+	SP     uint8
+}
+
+// Registers returns the current register values.
+func (c *Core) Registers() Registers {
+	return Registers{
+		A:      c.A,
+		X:      c.X,
+		Y:      c.Y,
+		PC:     c.PC,
+		Phlags: c.Phlags,
+		SP:     c.SP,
 	}
+}
+
+// SetRegisters overwrites all registers with the given values.
+func (c *Core) SetRegisters(r Registers) {
+	c.A = r.A
+	c.X = r.X
+	c.Y = r.Y
+	c.PC = r.PC
+	c.Phlags = r.Phlags
+	c.SP = r.SP
+}
+
+// NewRWCore creates a core where the whole 64k address space is RAM,
+// initialized from rom.  The image is copied so writes made while running
+// don't modify the caller's slice.
+func NewRWCore(rom []byte, instrLimit uint64, opts ...Option) (*Core, error) {
+	if err := validateRWROM(rom); err != nil {
+		return nil, err
+	}
+
+	mem := make([]byte, len(rom))
+	copy(mem, rom)
 
 	c := &Core{
 		A:      0,
@@ -67,24 +290,28 @@ func NewRWCore(rom []byte, instrLimit uint64) (*Core, error) {
 		SP:     0,
 
 		//memory: make([]byte, 0x1000), // no registers, no WRAM, no ROM
-		rom: rom,
+		rom: mem,
 
 		InstructionLimit: instrLimit,
 
-		fullRW:     true,
-		checkStuck: true,
+		fullRW:         true,
+		StuckThreshold: 1,
 		history:    [HistoryLength]string{},
 	}
 
-	c.PC = c.ReadWord(VECTOR_RESET)
-	return c, nil
-}
+	for _, opt := range opts {
+		opt(c)
+	}
 
-func NewCore(rom []byte, wram bool, instrLimit uint64) (*Core, error) {
-	if len(rom)%256 != 0 {
-		return nil, fmt.Errorf("ROM is not divisible by 256: %d", len(rom))
+	if c.hasStartPC {
+		c.PC = c.startPC
+	} else {
+		c.PC = c.ReadWord(VECTOR_RESET)
 	}
+	return c, nil
+}
 
+func NewCore(rom []byte, wram bool, instrLimit uint64, opts ...Option) (*Core, error) {
 	c := &Core{
 		A:      0,
 		X:      0,
@@ -93,8 +320,9 @@ func NewCore(rom []byte, wram bool, instrLimit uint64) (*Core, error) {
 		Phlags: 0,
 		SP:     0,
 
-		memory: make([]byte, 0x1000), // no registers, no WRAM, no ROM
-		rom:    rom,
+		memory:  make([]byte, 0x1000), // no registers, no WRAM, no ROM
+		romFill: 0xFF,
+		ramSeed: 1,
 
 		InstructionLimit: instrLimit,
 
@@ -105,43 +333,129 @@ func NewCore(rom []byte, wram bool, instrLimit uint64) (*Core, error) {
 		c.wram = make([]byte, 0x2000)
 	}
 
-	if len(c.rom) == 0 {
-		return nil, fmt.Errorf("No rom!")
+	for _, opt := range opts {
+		opt(c)
 	}
+
+	if err := c.loadROM(rom); err != nil {
+		return nil, err
+	}
+	c.fillRAM()
+
 	fmt.Printf("Rom length: %X\n", len(c.rom))
 
-	c.PC = c.ReadWord(VECTOR_RESET)
+	if c.hasStartPC {
+		c.PC = c.startPC
+	} else {
+		c.PC = c.ReadWord(VECTOR_RESET)
+		if c.validateReset && c.PC < 0x8000 {
+			return nil, fmt.Errorf("%w: $%04X", ErrBadResetVector, c.PC)
+		}
+	}
 
 	return c, nil
 }
 
 // Read address.  This will read from API registers if needed.
 func (c *Core) ReadByte(addr uint16) uint8 {
+	value := c.readByte(addr)
+	if c.accessLog != nil {
+		c.logAccess(addr, value, false)
+	}
+	return value
+}
+
+func (c *Core) readByte(addr uint16) uint8 {
 	c.lastReadAddr = addr
+	if c.readHandlers != nil {
+		if fn := c.readHandler(addr); fn != nil {
+			c.readRegister = true
+			return c.busRead(fn(addr))
+		}
+	}
+
+	if value, ok := c.peek(addr); ok {
+		return c.busRead(value)
+	}
+
+	// Software register space.  Reads here are treated as polling by the
+	// stuck detector.
+	if addr >= 0x1000 && addr < 0x6000 {
+		c.readRegister = true
+	}
+
+	return c.openBus(addr)
+}
+
+// PeekByte returns the value at addr without any side effects.  Read
+// handlers are bypassed and the value in the underlying storage is returned
+// instead.  The last read address and open bus value are left untouched.
+func (c *Core) PeekByte(addr uint16) uint8 {
+	if value, ok := c.peek(addr); ok {
+		return value
+	}
+	return c.openBus(addr)
+}
+
+// PeekWord is the side effect free version of ReadWord.
+func (c *Core) PeekWord(addr uint16) uint16 {
+	return uint16(c.PeekByte(addr)) | (uint16(c.PeekByte(addr+1)) << 8)
+}
+
+// peek returns the value stored at addr, or false if nothing is mapped
+// there.
+func (c *Core) peek(addr uint16) (uint8, bool) {
+	if c.romSegments != nil {
+		if seg := c.romSegment(addr); seg != nil {
+			return seg.Data[addr-seg.Base], true
+		}
+	}
+
+	// NewRWCore requires exactly 64k, so any uint16 address is in range.
+	// Address math is all done in uint16 and wraps from $FFFF to $0000.
 	if c.fullRW {
-		return c.rom[addr]
+		return c.rom[addr], true
 	}
 
 	if addr < 0x1000 {
-		return c.memory[addr]
+		return c.memory[addr], true
 	}
 
 	if addr >= 0x6000 && addr < 0x8000 {
 		if c.wram != nil {
-			// TODO: make sure this works with variable WRAM sizes (paging?)
-			return c.wram[addr%uint16(len(c.wram))]
+			return c.wram[c.wramIndex(addr)], true
 		}
-		return 0
+		return 0, false
 	}
 
 	if addr >= 0x8000 {
-		return c.rom[uint(addr)%uint(len(c.rom))]
+		return c.rom[c.romIndex(addr)], true
 	}
 
-	// "Open bus"  always return zero.
+	return 0, false
+}
+
+// busRead records a value driven onto the data bus for OpenBusLastRead.
+func (c *Core) busRead(value uint8) uint8 {
+	c.lastBusValue = value
+	return value
+}
+
+// openBus returns the value read from an unmapped address.
+func (c *Core) openBus(addr uint16) uint8 {
+	switch c.OpenBus {
+	case OpenBusConstant:
+		return c.OpenBusValue
+	case OpenBusLastRead:
+		return c.lastBusValue
+	case OpenBusHighByte:
+		return uint8(addr >> 8)
+	}
 	return 0
 }
 
+// ReadWord reads a little-endian word.  The high byte address wraps, so a
+// word at $FFFF is read from $FFFF and $0000.
 func (c *Core) ReadWord(addr uint16) uint16 {
 	defer func() { c.lastReadAddr = addr }() // will this fire off correctly? idk
 	return uint16(c.ReadByte(addr)) | (uint16(c.ReadByte(addr+1)) << 8)
@@ -149,6 +463,22 @@ func (c *Core) ReadWord(addr uint16) uint16 {
 
 // Write to an address.  This will delegate to API if needed.
 func (c *Core) WriteByte(addr uint16, value byte) {
+	c.lastWriteAddr = addr
+	if c.accessLog != nil {
+		c.logAccess(addr, value, true)
+	}
+	if c.writeHandlers != nil {
+		if fn := c.writeHandler(addr); fn != nil {
+			fn(addr, value)
+			return
+		}
+	}
+
+	if c.romSegments != nil && c.romSegment(addr) != nil {
+		c.romWrite(addr, value)
+		return
+	}
+
 	if c.fullRW {
 		c.rom[addr] = value
 		return
@@ -159,8 +489,119 @@ func (c *Core) WriteByte(addr uint16, value byte) {
 	} else if addr < 0x6000 {
 		// TODO: software registers
 	} else if addr >= 0x6000 && addr < 0x8000 && c.wram != nil {
-		c.wram[addr] = value
+		c.wram[c.wramIndex(addr)] = value
+	} else if addr >= 0x8000 {
+		c.romWrite(addr, value)
+	}
+}
+
+// romWrite applies the ROM write policy to a write that hit ROM.
+func (c *Core) romWrite(addr uint16, value uint8) {
+	switch c.romWrites {
+	case ROMWriteLog:
+		w := c.DebugFile
+		if w == nil {
+			w = os.Stdout
+		}
+		fmt.Fprintf(w, "[$%04X] write to ROM: $%04X = $%02X\n", c.PC, addr, value)
+
+	case ROMWriteError:
+		if c.instrErr == nil {
+			c.instrErr = fmt.Errorf("%w: [$%04X] $%04X = $%02X", ErrROMWrite, c.PC, addr, value)
+		}
+	}
+}
+
+// PokeByte writes value to the storage behind addr without any side effects.
+// Write handlers are bypassed and the last write address is left untouched.
+// Unlike WriteByte this will write to ROM and ROM segments, which are the
+// caller's slices for NewCore and MapROM.  Writes to unmapped addresses are
+// dropped.
+func (c *Core) PokeByte(addr uint16, value uint8) {
+	if seg := c.romSegment(addr); seg != nil {
+		seg.Data[addr-seg.Base] = value
+		return
+	}
+
+	if c.fullRW {
+		c.rom[addr] = value
+		return
+	}
+
+	if addr < 0x1000 {
+		c.memory[addr] = value
+	} else if addr >= 0x6000 && addr < 0x8000 && c.wram != nil {
+		c.wram[c.wramIndex(addr)] = value
+	} else if addr >= 0x8000 {
+		c.rom[c.romIndex(addr)] = value
+	}
+}
+
+// LoadBytes writes data into memory starting at addr.  Each byte goes through
+// WriteByte, so the normal memory map applies and writes to ROM or unmapped
+// space are dropped.  ErrLoadOverflow is returned without writing anything if
+// data would run past $FFFF.
+func (c *Core) LoadBytes(addr uint16, data []byte) error {
+	if int(addr)+len(data) > 0x10000 {
+		return fmt.Errorf("%w: %d bytes at $%04X", ErrLoadOverflow, len(data), addr)
+	}
+
+	for i, b := range data {
+		c.WriteByte(addr+uint16(i), b)
+	}
+	return nil
+}
+
+// LastReadAddr returns the address of the most recent memory read.  For
+// ReadWord this is the address of the low byte.
+func (c *Core) LastReadAddr() uint16 {
+	return c.lastReadAddr
+}
+
+// LastWriteAddr returns the address of the most recent memory write.
+func (c *Core) LastWriteAddr() uint16 {
+	return c.lastWriteAddr
+}
+
+// SetROMBank maps bank of the ROM, where each bank is size bytes, to
+// $8000.  ROM after the bank follows it in the address space, wrapping
+// around to the start of the ROM.
+func (c *Core) SetROMBank(bank, size int) {
+	c.romOffset = bank*size - 0x8000
+}
+
+// SetROMBankHandler calls fn with the value of every write to addr.  The
+// handler is expected to call SetROMBank to switch banks.
+func (c *Core) SetROMBankHandler(addr uint16, fn func(value uint8)) {
+	c.MapWrite(addr, addr, func(addr uint16, value uint8) {
+		fn(value)
+	})
+}
+
+// romIndex returns the offset into c.rom for an address at $8000 or above.
+// Without banking the ROM is mirrored through the address space.
+func (c *Core) romIndex(addr uint16) int {
+	idx := (int(addr) + c.romOffset) % len(c.rom)
+	if idx < 0 {
+		idx += len(c.rom)
 	}
+	return idx
+}
+
+// SetWRAMBank selects which 8k bank of WRAM is mapped to $6000-$7FFF.  Bank
+// numbers past the number of banks wrap around.
+func (c *Core) SetWRAMBank(bank int) {
+	c.wramBank = bank
+}
+
+// wramIndex returns the offset into c.wram for an address in the WRAM
+// window.  WRAM smaller than the window is mirrored.
+func (c *Core) wramIndex(addr uint16) int {
+	idx := (c.wramBank*0x2000 + int(addr-0x6000)) % len(c.wram)
+	if idx < 0 {
+		idx += len(c.wram)
+	}
+	return idx
 }
 
 func (c *Core) WriteInt(addr uint16, value uint8) {
@@ -175,36 +616,63 @@ func (c *Core) Run() error {
 	start := time.Now()
 	defer func() {fmt.Printf("time: %s\n", time.Now().Sub(start))}()
 
-	limit := false
-	if c.InstructionLimit > 0 {
-		//fmt.Printf("Setting instruction limit to %d\n", c.InstructionLimit)
-		limit = true
+	var count uint64
+	for {
+		if err := c.tick(); err != nil {
+			return err
+		}
+		count++
+
+		// A halt on the last allowed instruction still finishes the run.
+		if c.halted {
+			return nil
+		}
+
+		if c.InstructionLimit > 0 && count >= c.InstructionLimit {
+			return ErrInstructionLimit
+		}
 	}
+}
 
-	done := false
-	var err error
-	for !done {
-		err = c.tick()
+// RunUntil executes instructions until the PC reaches target at an
+// instruction boundary.  An error is returned if maxInstr instructions are
+// executed without reaching the target.
+func (c *Core) RunUntil(target uint16, maxInstr uint64) error {
+	for i := uint64(0); i < maxInstr; i++ {
+		if c.PC == target {
+			return nil
+		}
+
+		err := c.tick()
 		if err != nil {
 			return err
 		}
+	}
 
-		if limit {
-			c.InstructionLimit -= 1
-			if c.InstructionLimit <= 0 {
-				if c.testing {
-					return fmt.Errorf("Instruction limit hit")
-				}
-				done = true
-			}
+	if c.PC == target {
+		return nil
+	}
+	return fmt.Errorf("%w before reaching $%04X", ErrInstructionLimit, target)
+}
+
+// RunUntilMemEquals executes instructions until ReadByte(addr) equals
+// value, checked after each instruction.  This is for test ROMs that write a
+// result code when they finish.  The byte is read with ReadByte so a status
+// register backed by a read handler is seen.  Like Run, a trap that halts the
+// core ends the run without an error.  An error is returned if maxInstr
+// instructions are executed without a match.
+func (c *Core) RunUntilMemEquals(addr uint16, value uint8, maxInstr uint64) error {
+	for i := uint64(0); i < maxInstr; i++ {
+		if err := c.tick(); err != nil {
+			return err
 		}
 
-		if c.testing {
-			done = c.testDone
+		if c.halted || c.ReadByte(addr) == value {
+			return nil
 		}
 	}
 
-	return nil
+	return fmt.Errorf("%w before $%04X was $%02X", ErrInstructionLimit, addr, value)
 }
 
 func (c *Core) dumpHistory() {
@@ -228,73 +696,235 @@ func (c *Core) dumpHistory() {
 
 }
 
-func (c *Core) tick() error {
+func (c *Core) tick() (err error) {
+	// Turn a panic from a bug in the emulator, or a handler, into an error
+	// with enough state to report it.
+	pc := c.PC
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w at $%04X (opcode $%02X): %v\n%s",
+				ErrPanic, pc, c.PeekByte(pc), r, c.FormatRegisters())
+		}
+	}()
+
 	//c.PC += 1
-	if c.checkStuck {
-		if c.PC == c.lastPC {
+	if c.stopped {
+		return fmt.Errorf("%w at $%04X", ErrStopped, c.PC-1)
+	}
+
+	if c.nmiPending {
+		c.nmiPending = false
+		c.interrupt(VECTOR_NMI)
+	}
+
+	if c.waiting {
+		return fmt.Errorf("%w at $%04X", ErrWaiting, c.PC-1)
+	}
+
+	if c.StuckThreshold > 0 {
+		if c.PC == c.lastPC && !c.readRegister {
 			c.lastSame++
 		} else {
 			c.lastSame = 0
 			c.lastPC = c.PC
 		}
 
-		if c.lastSame > 0 {
-			c.dumpHistory()
-			return fmt.Errorf("Stuck")
+		if uint(c.lastSame) >= c.StuckThreshold {
+			if c.StuckHook == nil || !c.StuckHook(c, c.PC, c.lastSame) {
+				c.dumpHistory()
+				return fmt.Errorf("%w at $%04X (last read $%04X, last write $%04X)",
+					ErrStuck, c.PC, c.lastReadAddr, c.lastWriteAddr)
+			}
+			c.lastSame = 0
 		}
 	}
 
+	c.readRegister = false
 	opcode := c.ReadByte(c.PC)
 	//if c.fullRW {
 	//	fmt.Printf("[%06d] %04X: %02X\n", c.ticks, c.PC, opcode)
 	//}
 
-	if opcode == 0xFF && c.testing {
-		c.testDone = true
-		return nil // 0xFF means end of test
+	if fn, ok := c.traps[opcode]; ok {
+		c.ticks++
+		if fn(c) {
+			c.halted = true
+			return nil
+		}
+		c.PC += 1
+		return nil
+	}
+
+	if c.haltOn && opcode == c.HaltOpcode {
+		c.ticks++
+		c.halted = true
+		return nil
+	}
+
+	if c.variant == VariantNMOS && jamOpcodes[opcode] {
+		c.jammed = true
+		c.jamPC = c.PC
+		c.dumpHistory()
+		return fmt.Errorf("%w: [$%04X] $%02X", ErrJammed, c.PC, opcode)
 	}
 
 	//fn, ok := opcodes[opcode]
-	instr, ok := instructionList[opcode]
-	if !ok || instr == nil {
+	instr, ok := c.decode(opcode)
+	if !ok && c.TreatUnknownAsNop {
+		w := c.DebugFile
+		if w == nil {
+			w = os.Stdout
+		}
+		fmt.Fprintf(w, "[$%04X] unknown opcode $%02X treated as NOP\n", c.PC, opcode)
+
+		c.ticks++
+		c.addCycles(2)
+		c.PC += 1
+		return nil
+	}
+
+	if !ok {
 		c.dumpHistory()
-		return fmt.Errorf("OP Code not implemented: [$%04X] $%02X", c.PC, opcode)
+		return UnimplementedOpcodeError{Opcode: opcode, PC: c.PC}
 	}
 
 	oppc := c.PC
 
+	c.recordRewind()
+	if c.coverage != nil {
+		c.markCovered(oppc, c.instrLength(opcode, instr))
+	}
+	if c.opcodeCounts != nil {
+		c.opcodeCounts[opcode]++
+	}
+
+	var ops []uint8
+	if c.tracing() {
+		ops = c.instrBytes(opcode, instr, oppc)
+	}
+
+	// visual6502 shows the state at the opcode fetch, before the instruction
+	// runs.  Every other format shows the result.
+	visual := c.Debug && c.TraceFormat == TraceVisual6502
+	if visual {
+		c.trace(instr, oppc, ops)
+	}
+
 	c.ticks++
+	c.addCycles(uint64(instr.Cycles(c)))
+	flags := c.Phlags
 	instr.Execute(c)
 
-	if c.Debug {
-		l := instr.InstrLength(c)
-		ops := []string{}
-		for i := uint8(0); i < l; i++ {
-			ops = append(ops, fmt.Sprintf("%02X", c.ReadByte(oppc+uint16(i))))
+	if c.Debug && !visual {
+		c.trace(instr, oppc, ops)
+	}
+
+	if c.Phlags != flags {
+		c.flagChanges(oppc, flags)
+	}
+
+	if c.instrErr != nil {
+		err := c.instrErr
+		c.instrErr = nil
+		return err
+	}
+
+	return nil
+}
+
+// SetTrap calls fn instead of decoding opcode.  If fn returns true the core
+// halts with the PC still pointing at the trap opcode, otherwise execution
+// continues with the next byte.  A nil fn removes the trap.
+func (c *Core) SetTrap(opcode byte, fn func(c *Core) bool) {
+	if fn == nil {
+		delete(c.traps, opcode)
+		return
+	}
+
+	if c.traps == nil {
+		c.traps = make(map[byte]func(c *Core) bool)
+	}
+	c.traps[opcode] = fn
+}
+
+// Halted returns true if a trap has halted the core.
+func (c *Core) Halted() bool {
+	return c.halted
+}
+
+// haltTrap stops the run.  Tests install it with SetTrap on cores that
+// aren't test cores.
+func haltTrap(c *Core) bool {
+	return true
+}
+
+// OverrideInstruction replaces the instruction decoded for opcode on this
+// core only.  This takes priority over both the documented and undocumented
+// tables.  Passing a nil instruction makes the opcode unimplemented.
+func (c *Core) OverrideInstruction(opcode byte, instr Instruction) {
+	if c.instructions == nil {
+		c.instructions = make(map[byte]Instruction)
+	}
+
+	c.instructions[opcode] = instr
+}
+
+// NextInstruction returns the instruction at the PC without executing it,
+// and whether it's implemented.  The opcode is peeked, so this has no side
+// effects.
+func (c *Core) NextInstruction() (Instruction, bool) {
+	return c.decode(c.PeekByte(c.PC))
+}
+
+// decode looks up the instruction for the given opcode.
+func (c *Core) decode(opcode byte) (Instruction, bool) {
+	if c.instructions != nil {
+		if instr, ok := c.instructions[opcode]; ok {
+			return instr, instr != nil
 		}
+	}
 
-		dbgLine := fmt.Sprintf("[%06d] $%04X: %-9s %s %-17s %s %s",
-			c.ticks,
-			oppc,
-			strings.Join(ops, " "),
-			instr.Name(),
-			instr.AddressMeta().Asm(c, oppc),	// oppc == OP code PC
-			c.registerString(),
-			c.stackString(),
-		)
-
-		c.history[c.historyIdx] = dbgLine
-		c.historyIdx += 1
-		if c.historyIdx >= HistoryLength {
-			c.historyIdx = 0
+	if instr := c.variantInstruction(opcode); instr != nil {
+		return instr, true
+	}
+
+	instr := instructionList[opcode]
+	if instr == nil && c.allowIllegal && c.variant == VariantNMOS {
+		instr = illegalInstructionList[opcode]
+	}
+	return instr, instr != nil
+}
+
+// Instruction lengths by opcode, filled in from the instruction tables so
+// the hot paths don't have to ask the instruction.
+var opcodeLengths [256]uint8
+
+func init() {
+	for op := range opcodeLengths {
+		instr := instructionList[op]
+		if instr == nil {
+			instr = illegalInstructionList[op]
 		}
 
-		if c.DebugFile != nil {
-			fmt.Fprintln(c.DebugFile, dbgLine)
+		// Lengths only depend on the addressing mode, never the core.
+		if instr != nil {
+			opcodeLengths[op] = instr.InstrLength(nil)
 		}
 	}
+}
 
-	return nil
+// instrLength returns the length of instr, which was decoded from opcode.
+func (c *Core) instrLength(opcode byte, instr Instruction) uint8 {
+	if c.instructions != nil {
+		if _, ok := c.instructions[opcode]; ok {
+			return instr.InstrLength(c)
+		}
+	}
+
+	if c.variantInstruction(opcode) != nil {
+		return instr.InstrLength(c)
+	}
+	return opcodeLengths[opcode]
 }
 
 func (c *Core) stackString() string {
@@ -305,30 +935,35 @@ func (c *Core) stackString() string {
 	}
 
 	for i := length; i > 0; i--{
-		st = append(st, fmt.Sprintf("$%02X", c.ReadByte(uint16(c.SP + i) | 0x0100)))
+		st = append(st, fmt.Sprintf("$%02X", c.PeekByte(uint16(c.SP + i) | 0x0100)))
 	}
 
 	return strings.Join(st, " ")
 }
 
 func (c *Core) DumpMemoryRange(start, end uint16) {
+	fmt.Print(c.FormatMemoryRange(start, end))
+}
+
+// FormatMemoryRange returns the same output as DumpMemoryRange as a string.
+func (c *Core) FormatMemoryRange(start, end uint16) string {
+	sb := &strings.Builder{}
+	c.writeMemoryRange(sb, start, end)
+	return sb.String()
+}
+
+func (c *Core) writeMemoryRange(w io.Writer, start, end uint16) {
 	if end < start {
-		fmt.Println("Invalid dump range given")
+		fmt.Fprintln(w, "Invalid dump range given")
 		return
 	}
 
-	fmt.Printf("start: $%02X end: $%02X\n", start, end)
+	fmt.Fprintf(w, "start: $%04X end: $%04X\n", start, end)
 
-	vals := []byte{}
-	current := start
-
-	for current <= end {
-		vals = append(vals, c.ReadByte(current))
-		current++
-	}
-
-	for i, b := range vals {
-		fmt.Printf("$%02X: $%02X (%d)\n", i+int(start), b, b)
+	for i := 0; i <= int(end-start); i++ {
+		addr := start + uint16(i)
+		b := c.ReadByte(addr)
+		fmt.Fprintf(w, "$%04X: $%02X (%d)\n", addr, b, b)
 	}
 }
 
@@ -338,12 +973,32 @@ const (
 	FLAG_INTERRUPT uint8 = 0x04
 	FLAG_DECIMAL   uint8 = 0x08
 
+	// Bit 4 only exists in the status byte pushed to the stack, where it
+	// is set for BRK and PHP.  Bit 5 is set on every push.  PLP and RTI
+	// drop the pulled bit 4 and force bit 5 set.
 	FLAG_BREAK    uint8 = 0x30
 	FLAG_IRQ      uint8 = 0x20
 	FLAG_OVERFLOW uint8 = 0x40
 	FLAG_NEGATIVE uint8 = 0x80
 )
 
+// Status flag accessors.
+func (c *Core) Carry() bool     { return c.Phlags&FLAG_CARRY != 0 }
+func (c *Core) Zero() bool      { return c.Phlags&FLAG_ZERO != 0 }
+func (c *Core) Interrupt() bool { return c.Phlags&FLAG_INTERRUPT != 0 }
+func (c *Core) Decimal() bool   { return c.Phlags&FLAG_DECIMAL != 0 }
+func (c *Core) Overflow() bool  { return c.Phlags&FLAG_OVERFLOW != 0 }
+func (c *Core) Negative() bool  { return c.Phlags&FLAG_NEGATIVE != 0 }
+
+// SetFlag sets or clears the given FLAG_* bits.
+func (c *Core) SetFlag(flag uint8, on bool) {
+	if on {
+		c.Phlags |= flag
+	} else {
+		c.Phlags &^= flag
+	}
+}
+
 func flagToString(ph uint8) string {
 	switch ph {
 	case FLAG_CARRY:
@@ -413,35 +1068,137 @@ func (c *Core) registerString() string {
 }
 
 func (c *Core) DumpRegisters() {
-	fmt.Println(c.registerString())
+	fmt.Println(c.FormatRegisters())
+}
+
+// FormatRegisters returns the same output as DumpRegisters as a string.
+func (c *Core) FormatRegisters() string {
+	return c.registerString()
 }
 
 func (c *Core) DumpPage(page uint8) {
-	vals := []string{}
+	fmt.Print(c.FormatPage(page))
+}
+
+// FormatPage returns the same output as DumpPage as a string.
+func (c *Core) FormatPage(page uint8) string {
+	return c.FormatPageWith(page, PageHex)
+}
+
+// PageFormat selects extra columns for DumpPageWith and FormatPageWith.
+// Values can be combined.
+type PageFormat uint8
+
+const (
+	PageHex    PageFormat = 0      // hex bytes only
+	PageSigned PageFormat = 1 << 0 // add the bytes as signed decimal
+	PageAscii  PageFormat = 1 << 1 // add printable ASCII, with '.' for everything else
+)
+
+// DumpPageAscii prints a page with an ASCII column, like a hex editor.
+func (c *Core) DumpPageAscii(page uint8) {
+	c.DumpPageWith(page, PageAscii)
+}
+
+// DumpPageWith prints a page with the given extra columns.
+func (c *Core) DumpPageWith(page uint8, format PageFormat) {
+	fmt.Print(c.FormatPageWith(page, format))
+}
+
+// FormatPageWith returns the same output as DumpPageWith as a string.
+func (c *Core) FormatPageWith(page uint8, format PageFormat) string {
 	base := uint16(page) << 8
+	vals := make([]uint8, 256)
 	for i := uint16(0); i < 256; i++ {
-		vals = append(vals, fmt.Sprintf("%02X", c.ReadByte(base+i)))
+		vals[i] = c.ReadByte(base + i)
 	}
 
+	sb := &strings.Builder{}
 	for i := 0; i < 256; i += 16 {
-		fmt.Printf("%04X: %s\n", int(base)+i, strings.Join(vals[i:i+16], " "))
+		row := vals[i : i+16]
+
+		hex := []string{}
+		for _, v := range row {
+			hex = append(hex, fmt.Sprintf("%02X", v))
+		}
+		fmt.Fprintf(sb, "%04X: %s", int(base)+i, strings.Join(hex, " "))
+
+		if format&PageSigned != 0 {
+			dec := []string{}
+			for _, v := range row {
+				dec = append(dec, fmt.Sprintf("%4d", int8(v)))
+			}
+			fmt.Fprintf(sb, "  %s", strings.Join(dec, ""))
+		}
+
+		if format&PageAscii != 0 {
+			ascii := make([]byte, len(row))
+			for j, v := range row {
+				if v >= 0x20 && v < 0x7F {
+					ascii[j] = v
+				} else {
+					ascii[j] = '.'
+				}
+			}
+			fmt.Fprintf(sb, "  |%s|", ascii)
+		}
+
+		sb.WriteString("\n")
 	}
+	return sb.String()
 }
 
+// DumpMemoryToFile writes the output of WriteMemoryDump to a new file.
 func (c Core) DumpMemoryToFile(filename string) error {
-	vals := []string{}
-	for i := uint(0); i < 0x10000; i++ {
-		vals = append(vals, fmt.Sprintf("%02X", c.ReadByte(uint16(i))))
-	}
-
 	file, err := os.Create(filename)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
+	return c.WriteMemoryDump(file)
+}
+
+// WriteMemoryDump writes all 64k of memory to w as hex, 16 bytes per line
+// prefixed with the address.  Memory is read with PeekByte so read handlers
+// are not called.
+func (c Core) WriteMemoryDump(w io.Writer) error {
+	vals := []string{}
+	for i := uint(0); i < 0x10000; i++ {
+		vals = append(vals, fmt.Sprintf("%02X", c.PeekByte(uint16(i))))
+	}
+
 	for i := 0; i < 0x10000; i += 16 {
-		fmt.Fprintf(file, "%04X: %s\n", i, strings.Join(vals[i:i+16], " "))
+		if _, err := fmt.Fprintf(w, "%04X: %s\n", i, strings.Join(vals[i:i+16], " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteMemoryBinary writes all 64k of memory to w as raw bytes.  Memory is
+// read with PeekByte so read handlers are not called.
+func (c Core) WriteMemoryBinary(w io.Writer) error {
+	mem := make([]byte, 0x10000)
+	for i := range mem {
+		mem[i] = c.PeekByte(uint16(i))
+	}
+
+	_, err := w.Write(mem)
+	return err
+}
+
+// LoadMemoryBinary restores a 64k image written by WriteMemoryBinary.  Each
+// byte is stored with PokeByte, so ROM is overwritten and unmapped addresses
+// are ignored.  Memory is not modified if the image is short.
+func (c *Core) LoadMemoryBinary(r io.Reader) error {
+	mem := make([]byte, 0x10000)
+	if _, err := io.ReadFull(r, mem); err != nil {
+		return fmt.Errorf("reading memory image: %w", err)
+	}
+
+	for i, b := range mem {
+		c.PokeByte(uint16(i), b)
 	}
 	return nil
 }
@@ -450,6 +1207,25 @@ func (c Core) Ticks() uint64 {
 	return c.ticks
 }
 
+// CallDepth returns the current subroutine nesting depth.  This is
+// incremented when entering a subroutine via JSR or an interrupt via BRK, and
+// decremented by RTS and RTI.
+func (c Core) CallDepth() int {
+	return c.callDepth
+}
+
+// SetAllowIllegal enables or disables decoding of the undocumented NMOS
+// opcodes.  They are disabled by default.
+func (c *Core) SetAllowIllegal(allow bool) {
+	c.allowIllegal = allow
+}
+
+// JamPC returns the address of the KIL opcode that jammed the CPU, and
+// whether the CPU has jammed at all.
+func (c Core) JamPC() (uint16, bool) {
+	return c.jamPC, c.jammed
+}
+
 func (c *Core) tlog(msg string) {
 	if c.t != nil {
 		c.t.Log(msg)
@@ -463,17 +1239,16 @@ func (c *Core) tlogf(fmt string, args ...interface{}) {
 }
 
 func testCore(rom []byte, mem []byte, wram []byte) (*Core, error) {
-	core, err := NewCore(rom, false, 1000)
+	core, err := NewCore(rom, false, 1000, HaltOn(0xFF))
 	if err != nil {
 		return nil, err
 	}
 	core.testing = true
 
 	if mem != nil {
-		for len(mem) < 0x1000 {
-			mem = append(mem, 0x00)
+		if err = core.LoadBytes(0x0000, mem); err != nil {
+			return nil, err
 		}
-		core.memory = mem
 	}
 
 	if wram != nil {
@@ -483,7 +1258,12 @@ func testCore(rom []byte, mem []byte, wram []byte) (*Core, error) {
 	return core, core.Run()
 }
 
-func padWithVectors(rom []byte, nmi, reset, irq uint16) []byte {
+// PadWithVectors pads rom with $FF bytes up to the next 256 byte boundary
+// and writes the NMI, RESET, and IRQ vectors into the last six bytes in
+// little-endian order.  A ROM that is already a multiple of 256 bytes isn't
+// padded, so its last six bytes are overwritten.  The returned slice may
+// share memory with rom.
+func PadWithVectors(rom []byte, nmi, reset, irq uint16) []byte {
 	for len(rom)%256 != 0 {
 		rom = append(rom, 0xFF)
 	}
@@ -529,6 +1309,10 @@ func (c *Core) setZeroNegative(value uint8) {
 	//fmt.Printf("%s -> %s\n", prev, flagsToString(c.Phlags))
 }
 
+func (c *Core) setCarry(set bool) {
+	c.SetFlag(FLAG_CARRY, set)
+}
+
 // addrRelative works differently than all other addressing functions.
 // It takes the value for offset, and uses the PC of the instruction
 // as the start point.  Call this before incrementing PC.
@@ -552,35 +1336,30 @@ func TwosCompInv(value uint8) (uint8, bool) {
 	return value, false
 }
 
+// twosCompAdd adds a, b, and the carry flag, setting the carry, overflow,
+// zero, and negative flags.
 func (c *Core) twosCompAdd(a, b uint8) uint8 {
-	carry := uint8(0)
+	carry := uint16(0)
 	if (c.Phlags & FLAG_CARRY) == FLAG_CARRY {
 		carry = 1
 	}
-	val := a + b + carry
 
-	if b < a {
-		// set carry
-		c.Phlags = c.Phlags | FLAG_CARRY
-	} else {
-		// reset carry
-		c.Phlags = c.Phlags & (FLAG_CARRY ^ 0xFF)
-	}
+	sum := uint16(a) + uint16(b) + carry
+	val := uint8(sum)
+	c.setCarry(sum > 0xFF)
 
-	if (a & 0x80) != (val & 0x80) {
-		c.Phlags = c.Phlags | FLAG_OVERFLOW
-	} else {
-		c.Phlags = c.Phlags & (FLAG_OVERFLOW ^ 0xFF)
-	}
+	// Overflow is set when both inputs have the same sign and the result
+	// has the other sign.
+	c.SetFlag(FLAG_OVERFLOW, (a^val)&(b^val)&0x80 != 0)
 
 	c.setZeroNegative(val)
 	return val
 }
 
+// twosCompSubtract subtracts b and the inverted carry flag from a.  This is
+// an add of the ones' complement of b; the carry flag acts as "not borrow".
 func (c *Core) twosCompSubtract(a, b uint8) uint8 {
-	//b = (b ^ 0xFF) + 1
-	b = (b - 1) ^ 0xFF
-	return c.twosCompAdd(a, b)
+	return c.twosCompAdd(a, b^0xFF)
 }
 
 func (c *Core) pushAddress(addr uint16) {
@@ -595,9 +1374,22 @@ func (c *Core) pullAddress() uint16 {
 func (c *Core) pushByte(val uint8) {
 	c.WriteByte(uint16(c.SP) | 0x0100, val)
 	c.SP -= 1
+	if c.SP == 0xFF && c.StackGuard != nil {
+		c.StackGuard(c, true)
+	}
+	if c.StackHook != nil {
+		c.StackHook(c, true, val, c.SP)
+	}
 }
 
 func (c *Core) pullByte() uint8 {
 	c.SP += 1
-	return c.ReadByte(uint16(c.SP) | 0x0100)
+	if c.SP == 0x00 && c.StackGuard != nil {
+		c.StackGuard(c, false)
+	}
+	val := c.ReadByte(uint16(c.SP) | 0x0100)
+	if c.StackHook != nil {
+		c.StackHook(c, false, val, c.SP)
+	}
+	return val
 }
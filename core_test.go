@@ -1,9 +1,14 @@
 package emu
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"strings"
 	"testing"
+	"time"
 )
 
 var testsRun int = 0
@@ -62,6 +67,38 @@ var memoryBased = []memTest{
 		regState{x: 2},
 		regState{0x00, 0x02, 0x00, 0x8002, 0x00, 0x00}},
 
+	// Shifts and rotates on memory
+	memTest{
+		"OP_ASL_ZP",
+		[]byte{OP_ASL_ZP, 0x81},
+		memVal{0x0081, 0x02},
+		regState{},
+		regState{pc: 0x8002, phlags: FLAG_CARRY}},
+	memTest{
+		"OP_ASL_AB",
+		[]byte{OP_ASL_AB, 0x00, 0x03},
+		memVal{0x0300, 0x00},
+		regState{},
+		regState{pc: 0x8003, phlags: FLAG_ZERO}},
+	memTest{
+		"OP_LSR_ZX",
+		[]byte{OP_LSR_ZX, 0x01},
+		memVal{0x0003, 0x01},
+		regState{x: 2},
+		regState{x: 2, pc: 0x8002, phlags: FLAG_CARRY}},
+	memTest{
+		"OP_ROL_AB",
+		[]byte{OP_ROL_AB, 0x00, 0x03},
+		memVal{0x0300, 0x01},
+		regState{phlags: FLAG_CARRY},
+		regState{pc: 0x8003}},
+	memTest{
+		"OP_ROR_AX",
+		[]byte{OP_ROR_AX, 0x00, 0x03},
+		memVal{0x0302, 0x80},
+		regState{x: 2, phlags: FLAG_CARRY},
+		regState{x: 2, pc: 0x8003, phlags: FLAG_NEGATIVE}},
+
 	// STA
 	memTest{
 		"OP_STA_AB",
@@ -262,6 +299,50 @@ var testData_A = []basicTest{
 		regState{x: 0x03},
 		regState{0x00, 0x03, 0x04, 0x8002, 0x00, 0x00}},
 
+	// Shifts and rotates on the accumulator
+	basicTest{
+		"OP_ASL_AC",
+		[]byte{OP_ASL_AC},
+		regState{a: 0x81},
+		regState{a: 0x02, pc: 0x8001, phlags: FLAG_CARRY}},
+	basicTest{
+		"OP_ASL_AC",
+		[]byte{OP_ASL_AC},
+		regState{a: 0x40, phlags: FLAG_CARRY},
+		regState{a: 0x80, pc: 0x8001, phlags: FLAG_NEGATIVE}},
+	basicTest{
+		"OP_LSR_AC",
+		[]byte{OP_LSR_AC},
+		regState{a: 0x01},
+		regState{a: 0x00, pc: 0x8001, phlags: FLAG_CARRY | FLAG_ZERO}},
+	basicTest{
+		"OP_ROL_AC",
+		[]byte{OP_ROL_AC},
+		regState{a: 0x80, phlags: FLAG_CARRY},
+		regState{a: 0x01, pc: 0x8001, phlags: FLAG_CARRY}},
+	basicTest{
+		"OP_ROR_AC",
+		[]byte{OP_ROR_AC},
+		regState{a: 0x02, phlags: FLAG_CARRY},
+		regState{a: 0x81, pc: 0x8001, phlags: FLAG_NEGATIVE}},
+
+	// BIT
+	basicTest{
+		"OP_BIT_ZP",
+		[]byte{OP_BIT_ZP, 0xC0},
+		regState{a: 0x01},
+		regState{a: 0x01, pc: 0x8002, phlags: FLAG_ZERO | FLAG_NEGATIVE | FLAG_OVERFLOW}},
+	basicTest{
+		"OP_BIT_ZP",
+		[]byte{OP_BIT_ZP, 0x41},
+		regState{a: 0x01, phlags: FLAG_ZERO | FLAG_NEGATIVE},
+		regState{a: 0x01, pc: 0x8002, phlags: FLAG_OVERFLOW}},
+	basicTest{
+		"OP_BIT_AB",
+		[]byte{OP_BIT_AB, 0x00, 0x80}, // $2C
+		regState{a: 0xD3, phlags: FLAG_NEGATIVE | FLAG_OVERFLOW},
+		regState{a: 0xD3, pc: 0x8003, phlags: FLAG_ZERO}},
+
 	basicTest{
 		"OP_NOP",
 		[]byte{OP_NOP},
@@ -350,7 +431,7 @@ func TestBasic(t *testing.T) {
 			ticksran := 0
 
 			//for i := 0; i < bt.ticks; i++ {
-			for !core.testDone {
+			for !core.halted {
 				err = core.tick()
 				if err != nil {
 					//core.dumpPage(0, t)
@@ -413,7 +494,7 @@ func TestMemory(t *testing.T) {
 			core.setRegisters(t, mt.regInitial)
 			ticksran := 0
 
-			for !core.testDone {
+			for !core.halted {
 				err = core.tick()
 				if err != nil {
 					t.Fatalf("%s: %v", mt.name, err)
@@ -438,6 +519,472 @@ func TestMemory(t *testing.T) {
 	}
 }
 
+func TestJam(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_NOP, 0x02}, 0x8000, 0x8000, 0x8000)
+	core, err := testCore(rom, nil, nil)
+	if !errors.Is(err, ErrJammed) {
+		t.Fatalf("Expected ErrJammed, got: %v", err)
+	}
+
+	pc, jammed := core.JamPC()
+	if !jammed {
+		t.Errorf("Core did not record the jam")
+	}
+
+	if pc != 0x8001 {
+		t.Errorf("Incorrect jam PC: Exp:$8001 Got:$%04X", pc)
+	}
+}
+
+func TestRunUntil(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDX_IM, 0x05,
+		OP_LDY_IM, 0x00,
+		OP_INY, // $8004: loop
+		OP_DEX,
+		OP_BNE, 0xFC, // loop
+		OP_NOP, // $8008: exit
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = core.RunUntil(0x8008, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	core.checkRegisters(t, "RunUntil", regState{x: 0x00, y: 0x05, pc: 0x8008, phlags: FLAG_ZERO})
+
+	core, err = NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = core.RunUntil(0x8008, 10)
+	if err == nil {
+		t.Errorf("Expected an error when the instruction limit is hit")
+	}
+}
+
+func TestRunUntilMemEquals(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_IM, 0x41,
+		OP_STA_AB, 0x00, 0x02,
+		OP_CLC,
+		OP_ADC_IM, 0x01,
+		OP_STA_AB, 0x00, 0x02, // $8008
+		OP_NOP, // $800B
+		OP_NOP,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = core.RunUntilMemEquals(0x0200, 0x42, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.PC != 0x800B {
+		t.Errorf("Incorrect PC: Exp:$800B Got:$%04X", core.PC)
+	}
+
+	core, err = NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = core.RunUntilMemEquals(0x0200, 0x42, 4)
+	if !errors.Is(err, ErrInstructionLimit) {
+		t.Errorf("Expected ErrInstructionLimit, got %v", err)
+	}
+
+	// A status register backed by handlers instead of RAM.
+	core, err = NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var status uint8
+	core.MapRead(0x0200, 0x0200, func(addr uint16) uint8 { return status })
+	core.MapWrite(0x0200, 0x0200, func(addr uint16, value uint8) { status = value })
+
+	if err = core.RunUntilMemEquals(0x0200, 0x42, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.PC != 0x800B {
+		t.Errorf("Incorrect PC with a read handler: Exp:$800B Got:$%04X", core.PC)
+	}
+
+	// A halt stops the run before the limit.
+	core, err = NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SetTrap(0xFF, haltTrap)
+
+	if err = core.RunUntilMemEquals(0x0200, 0x99, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	if !core.Halted() || core.PC != 0x800D {
+		t.Errorf("Run did not stop at the halt: halted:%t PC:$%04X", core.Halted(), core.PC)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	t.Run("Stuck", func(t *testing.T) {
+		rom := make([]byte, 0x10000)
+		rom[0x8000] = OP_JMP_AB
+		rom[0x8001] = 0x00
+		rom[0x8002] = 0x80
+		rom[VECTOR_RESET+1] = 0x80
+
+		core, err := NewRWCore(rom, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = core.Run()
+		if !errors.Is(err, ErrStuck) {
+			t.Errorf("Expected ErrStuck, got: %v", err)
+		}
+	})
+
+	t.Run("InstructionLimit", func(t *testing.T) {
+		rom := PadWithVectors([]byte{OP_JMP_AB, 0x00, 0x80}, 0x8000, 0x8000, 0x8000)
+		_, err := testCore(rom, nil, nil)
+		if !errors.Is(err, ErrInstructionLimit) {
+			t.Errorf("Expected ErrInstructionLimit, got: %v", err)
+		}
+	})
+
+	t.Run("UnimplementedOpcode", func(t *testing.T) {
+		rom := PadWithVectors([]byte{OP_NOP, 0x03}, 0x8000, 0x8000, 0x8000)
+		_, err := testCore(rom, nil, nil)
+		if !errors.Is(err, ErrUnimplementedOpcode) {
+			t.Errorf("Expected ErrUnimplementedOpcode, got: %v", err)
+		}
+
+		var uerr UnimplementedOpcodeError
+		if !errors.As(err, &uerr) {
+			t.Fatalf("Expected an UnimplementedOpcodeError, got: %v", err)
+		}
+
+		if uerr.Opcode != 0x03 {
+			t.Errorf("Incorrect opcode: Exp:$03 Got:$%02X", uerr.Opcode)
+		}
+
+		if uerr.PC != 0x8001 {
+			t.Errorf("Incorrect PC: Exp:$8001 Got:$%04X", uerr.PC)
+		}
+	})
+}
+
+func TestTreatUnknownAsNop(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_IM, 0x01,
+		0x03,
+		0x13,
+		OP_LDX_IM, 0x02,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := &bytes.Buffer{}
+	core.DebugFile = log
+	core.TreatUnknownAsNop = true
+
+	if err = core.RunUntil(0x8006, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.A != 0x01 || core.X != 0x02 {
+		t.Errorf("Incorrect registers: Exp:A:$01 X:$02 Got:A:$%02X X:$%02X", core.A, core.X)
+	}
+
+	exp := "[$8002] unknown opcode $03 treated as NOP\n" +
+		"[$8003] unknown opcode $13 treated as NOP\n"
+	if log.String() != exp {
+		t.Errorf("Incorrect log:\nExp:%q\nGot:%q", exp, log.String())
+	}
+}
+
+func TestStuckThreshold(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_JMP_AB, 0x00, 0x80}, 0x8000, 0x8000, 0x8000)
+
+	t.Run("InfiniteLoop", func(t *testing.T) {
+		core, err := NewCore(rom, false, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		core.StuckThreshold = 3
+
+		err = core.Run()
+		if !errors.Is(err, ErrStuck) {
+			t.Errorf("Expected ErrStuck, got: %v", err)
+		}
+
+		if core.Ticks() != 3 {
+			t.Errorf("Incorrect tick count: Exp:3 Got:%d", core.Ticks())
+		}
+	})
+
+	t.Run("Hook", func(t *testing.T) {
+		core, err := NewCore(rom, false, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		core.StuckThreshold = 3
+
+		calls := 0
+		core.StuckHook = func(c *Core, pc uint16, count int) bool {
+			calls++
+			if pc != 0x8000 {
+				t.Errorf("Incorrect PC: Exp:$8000 Got:$%04X", pc)
+			}
+			if count != 3 {
+				t.Errorf("Incorrect count: Exp:3 Got:%d", count)
+			}
+			return calls < 3
+		}
+
+		err = core.Run()
+		if !errors.Is(err, ErrStuck) {
+			t.Errorf("Expected ErrStuck, got: %v", err)
+		}
+
+		if calls != 3 {
+			t.Errorf("Incorrect hook calls: Exp:3 Got:%d", calls)
+		}
+
+		// Three instructions before each check, and the two that continued
+		// each ran their instruction.
+		if core.Ticks() != 9 {
+			t.Errorf("Incorrect tick count: Exp:9 Got:%d", core.Ticks())
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		core, err := NewCore(rom, false, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Runs to the limit instead of stopping as stuck.
+		err = core.Run()
+		if !errors.Is(err, ErrInstructionLimit) {
+			t.Errorf("Expected ErrInstructionLimit, got: %v", err)
+		}
+	})
+
+	t.Run("PollingLoop", func(t *testing.T) {
+		core, err := NewCore(rom, false, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		core.StuckThreshold = 3
+
+		// JMP ($4000) from $0000.  The pointer is read from register
+		// space, which returns zero and lands back on the same JMP.
+		core.memory[0] = OP_JMP_ID
+		core.memory[1] = 0x00
+		core.memory[2] = 0x40
+		core.PC = 0x0000
+
+		err = core.Run()
+		if !errors.Is(err, ErrInstructionLimit) {
+			t.Errorf("Expected ErrInstructionLimit, got: %v", err)
+		}
+
+		if core.PC != 0x0000 {
+			t.Errorf("Incorrect PC: Exp:$0000 Got:$%04X", core.PC)
+		}
+	})
+}
+
+func TestDumpMemoryRange(t *testing.T) {
+	core := newTestCore(t)
+	for i := 0; i < 0x1000; i++ {
+		core.memory[i] = uint8(i)
+	}
+
+	lines := strings.Split(strings.TrimSpace(core.FormatMemoryRange(0x0FF0, 0x1010)), "\n")
+	if len(lines) != 0x22 {
+		t.Fatalf("Incorrect line count: Exp:%d Got:%d", 0x22, len(lines))
+	}
+
+	if lines[0] != "start: $0FF0 end: $1010" {
+		t.Errorf("Incorrect header: %q", lines[0])
+	}
+
+	for i, line := range lines[1:] {
+		addr := 0x0FF0 + i
+		val := 0
+		if addr < 0x1000 {
+			val = addr & 0xFF
+		}
+
+		exp := fmt.Sprintf("$%04X: $%02X (%d)", addr, val, val)
+		if line != exp {
+			t.Errorf("Incorrect line %d: Exp:%q Got:%q", i, exp, line)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	core := newTestCore(t)
+	for i := 0; i < 256; i++ {
+		core.memory[0x0200+i] = uint8(i)
+	}
+
+	core.A = 0x80
+	core.X = 0x01
+	core.Y = 0xFF
+	core.SP = 0xFD
+	core.Phlags = FLAG_NEGATIVE | FLAG_CARRY
+
+	expRegs := "A: 80 (128) X: 01 (1  ) Y: FF (255) SP: FD (253) [81] N------C"
+	if got := core.FormatRegisters(); got != expRegs {
+		t.Errorf("Incorrect FormatRegisters():\nExp:%q\nGot:%q", expRegs, got)
+	}
+
+	page := core.FormatPage(0x02)
+	lines := strings.Split(strings.TrimSuffix(page, "\n"), "\n")
+	if len(lines) != 16 {
+		t.Fatalf("Incorrect FormatPage() line count: Exp:16 Got:%d", len(lines))
+	}
+
+	expLine := "0200: 00 01 02 03 04 05 06 07 08 09 0A 0B 0C 0D 0E 0F"
+	if lines[0] != expLine {
+		t.Errorf("Incorrect first page line:\nExp:%q\nGot:%q", expLine, lines[0])
+	}
+
+	expLine = "02F0: F0 F1 F2 F3 F4 F5 F6 F7 F8 F9 FA FB FC FD FE FF"
+	if lines[15] != expLine {
+		t.Errorf("Incorrect last page line:\nExp:%q\nGot:%q", expLine, lines[15])
+	}
+
+	expRange := "start: $0201 end: $0202\n$0201: $01 (1)\n$0202: $02 (2)\n"
+	if got := core.FormatMemoryRange(0x0201, 0x0202); got != expRange {
+		t.Errorf("Incorrect FormatMemoryRange():\nExp:%q\nGot:%q", expRange, got)
+	}
+}
+
+func TestRegisters(t *testing.T) {
+	core := newTestCore(t)
+	regs := Registers{
+		A:      0x12,
+		X:      0x34,
+		Y:      0x56,
+		PC:     0x789A,
+		Phlags: FLAG_CARRY | FLAG_OVERFLOW,
+		SP:     0xBC,
+	}
+
+	core.SetRegisters(regs)
+	if got := core.Registers(); got != regs {
+		t.Errorf("Registers did not round trip:\nExp:%+v\nGot:%+v", regs, got)
+	}
+
+	core.checkRegisters(t, "SetRegisters", regState{0x12, 0x34, 0x56, 0x789A, FLAG_CARRY | FLAG_OVERFLOW, 0xBC})
+}
+
+func TestCallDepth(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_JSR, 0x06, 0x80, // $8000
+		OP_NOP, // $8003
+		OP_NOP,
+		OP_NOP,
+		OP_JSR, 0x0A, 0x80, // $8006: sub1
+		OP_RTS, // $8009
+		OP_NOP, // $800A: sub2
+		OP_RTS,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SP = 0xFF
+
+	checkpoints := []struct {
+		pc    uint16
+		depth int
+	}{
+		{0x8006, 1},
+		{0x800A, 2},
+		{0x8009, 1},
+		{0x8003, 0},
+	}
+
+	for _, cp := range checkpoints {
+		err = core.RunUntil(cp.pc, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if core.CallDepth() != cp.depth {
+			t.Errorf("Incorrect call depth at $%04X: Exp:%d Got:%d", cp.pc, cp.depth, core.CallDepth())
+		}
+	}
+
+	// Unbalanced RTS
+	core.PC = 0x800B
+	err = core.tick()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if core.CallDepth() != 0 {
+		t.Errorf("Call depth went negative: %d", core.CallDepth())
+	}
+}
+
+func TestJSRReturnAddress(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_NOP,
+		OP_JSR, 0x06, 0x80, // $8001
+		OP_NOP, // $8004
+		OP_NOP,
+		OP_RTS, // $8006
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SP = 0xFF
+
+	err = core.RunUntil(0x8006, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Return address should point to the last byte of the JSR
+	ret := core.ReadWord(0x01FE)
+	if ret != 0x8003 {
+		t.Errorf("Incorrect return address pushed: Exp:$8003 Got:$%04X", ret)
+	}
+
+	err = core.tick()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if core.PC != 0x8004 {
+		t.Errorf("Incorrect PC after RTS: Exp:$8004 Got:$%04X", core.PC)
+	}
+}
+
 func TestEnd(t *testing.T) {
 	t.Logf("Tests run: %d", testsRun)
 }
@@ -482,7 +1029,7 @@ func (core *Core) setRegisters(t *testing.T, r regState) {
 
 func (c *Core) resetTest(t *testing.T, rom, ram []byte) error {
 	t.Helper()
-	rom = padWithVectors(rom, 0x8000, 0x8000, 0x8000)
+	rom = PadWithVectors(rom, 0x8000, 0x8000, 0x8000)
 	if len(rom)%256 != 0 {
 		return fmt.Errorf("ROM is not divisible by 256: %d", len(rom))
 	}
@@ -496,7 +1043,7 @@ func (c *Core) resetTest(t *testing.T, rom, ram []byte) error {
 		c.memory = make([]byte, 0x1000)
 	}
 
-	c.testDone = false
+	c.halted = false
 
 	// fill zero page with some data
 	for i := 0; i < 256; i++ {
@@ -546,6 +1093,993 @@ func newTestCore(t *testing.T) *Core {
 
 		InstructionLimit: 0,
 		testing:          true,
+		HaltOpcode:       0xFF,
+		haltOn:           true,
 		t:                t,
 	}
 }
+
+func TestPadWithVectors(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_NOP, OP_NOP, OP_NOP}, 0x1234, 0x8000, 0xABCD)
+
+	if len(rom) != 256 {
+		t.Fatalf("Incorrect length: Exp:256 Got:%d", len(rom))
+	}
+
+	for i := 3; i < 250; i++ {
+		if rom[i] != 0xFF {
+			t.Fatalf("Incorrect padding at %d: Exp:$FF Got:$%02X", i, rom[i])
+		}
+	}
+
+	exp := []byte{0x34, 0x12, 0x00, 0x80, 0xCD, 0xAB}
+	for i, b := range exp {
+		if rom[250+i] != b {
+			t.Errorf("Incorrect vector byte at %d: Exp:$%02X Got:$%02X", 250+i, b, rom[250+i])
+		}
+	}
+}
+
+func TestOpenBus(t *testing.T) {
+	tests := []struct {
+		name string
+		mode OpenBusMode
+		exp  uint8
+	}{
+		{"zero", OpenBusZero, 0x00},
+		{"constant", OpenBusConstant, 0xEA},
+		{"last read", OpenBusLastRead, 0x42},
+		{"high byte", OpenBusHighByte, 0x30},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			core, err := NewCore(PadWithVectors([]byte{OP_NOP}, 0x8000, 0x8000, 0x8000), false, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			core.OpenBus = tc.mode
+			core.OpenBusValue = 0xEA
+			core.memory[0x10] = 0x42
+
+			core.ReadByte(0x0010)
+			if val := core.ReadByte(0x3000); val != tc.exp {
+				t.Errorf("Incorrect register space value: Exp:$%02X Got:$%02X", tc.exp, val)
+			}
+
+			// WRAM is unmapped when it's disabled.
+			exp := tc.exp
+			if tc.mode == OpenBusHighByte {
+				exp = 0x60
+			}
+			core.ReadByte(0x0010)
+			if val := core.ReadByte(0x6000); val != exp {
+				t.Errorf("Incorrect WRAM value: Exp:$%02X Got:$%02X", exp, val)
+			}
+		})
+	}
+}
+
+func TestLastAccessAddr(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_AB, 0x34, 0x02,
+		OP_STA_AB, 0x78, 0x05,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = core.Step(); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.LastReadAddr() != 0x0234 {
+		t.Errorf("Incorrect last read address: Exp:$0234 Got:$%04X", core.LastReadAddr())
+	}
+
+	if err = core.Step(); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.LastWriteAddr() != 0x0578 {
+		t.Errorf("Incorrect last write address: Exp:$0578 Got:$%04X", core.LastWriteAddr())
+	}
+}
+
+func TestLoadBytes(t *testing.T) {
+	core, err := NewCore(PadWithVectors([]byte{OP_NOP}, 0x8000, 0x8000, 0x8000), false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte{0x01, 0x02, 0x03, 0x04, 0x05}
+	if err = core.LoadBytes(0x0300, data); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, b := range data {
+		addr := 0x0300 + uint16(i)
+		if val := core.ReadByte(addr); val != b {
+			t.Errorf("Incorrect value at $%04X: Exp:$%02X Got:$%02X", addr, b, val)
+		}
+	}
+
+	if err = core.LoadBytes(0xFFFE, data); !errors.Is(err, ErrLoadOverflow) {
+		t.Errorf("Expected ErrLoadOverflow, got %v", err)
+	}
+
+	// Exactly filling the end of memory is fine.
+	if err = core.LoadBytes(0xFFFB, data); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestRWCoreCopiesROM(t *testing.T) {
+	rom := make([]byte, 0x10000)
+	copy(rom[0x8000:], []byte{
+		OP_LDA_IM, 0x42,
+		OP_STA_AB, 0x00, 0x02,
+		OP_STA_AB, 0x02, 0x80, // overwrite the code itself
+	})
+	rom[VECTOR_RESET+1] = 0x80
+
+	core, err := NewRWCore(rom, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = core.RunUntil(0x8008, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.ReadByte(0x0200) != 0x42 {
+		t.Fatalf("Write did not land in core memory")
+	}
+
+	if rom[0x0200] != 0x00 || rom[0x8002] != OP_STA_AB {
+		t.Errorf("Core writes modified the input ROM")
+	}
+
+	fresh, err := NewRWCore(rom, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if val := fresh.ReadByte(0x0200); val != 0x00 {
+		t.Errorf("Incorrect value in fresh core: Exp:$00 Got:$%02X", val)
+	}
+}
+
+func TestFormatPageWith(t *testing.T) {
+	core, err := NewCore(PadWithVectors([]byte{OP_NOP}, 0x8000, 0x8000, 0x8000), false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = core.LoadBytes(0x0300, []byte{
+		'H', 'e', 'l', 'l', 'o', ',', ' ', '6', '5', '0', '2', '!',
+		0x00, 0x0A, 0x7F, 0xFF,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(core.FormatPageWith(0x03, PageAscii), "\n")
+	expLine := "0300: 48 65 6C 6C 6F 2C 20 36 35 30 32 21 00 0A 7F FF  |Hello, 6502!....|"
+	if lines[0] != expLine {
+		t.Errorf("Incorrect ASCII line:\nExp:%q\nGot:%q", expLine, lines[0])
+	}
+
+	expLine = "0310: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00  |................|"
+	if lines[1] != expLine {
+		t.Errorf("Incorrect ASCII line:\nExp:%q\nGot:%q", expLine, lines[1])
+	}
+
+	lines = strings.Split(core.FormatPageWith(0x03, PageSigned|PageAscii), "\n")
+	expLine = "0300: 48 65 6C 6C 6F 2C 20 36 35 30 32 21 00 0A 7F FF" +
+		"    72 101 108 108 111  44  32  54  53  48  50  33   0  10 127  -1" +
+		"  |Hello, 6502!....|"
+	if lines[0] != expLine {
+		t.Errorf("Incorrect signed line:\nExp:%q\nGot:%q", expLine, lines[0])
+	}
+}
+
+func TestWriteMemoryDump(t *testing.T) {
+	core, err := NewRWCore(romAt([]byte{OP_NOP}, 0x8000), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = core.LoadBytes(0x0010, []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xAB, 0xCD, 0xEF})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err = core.WriteMemoryDump(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 0x1000 {
+		t.Fatalf("Incorrect line count: Exp:4096 Got:%d", len(lines))
+	}
+
+	exp := map[int]string{
+		0x000: "0000: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00",
+		0x001: "0010: 01 23 45 67 89 AB CD EF 00 00 00 00 00 00 00 00",
+		0x800: "8000: EA 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00",
+		0xFFF: "FFF0: 00 00 00 00 00 00 00 00 00 00 00 00 00 80 00 00",
+	}
+
+	for i, line := range exp {
+		if lines[i] != line {
+			t.Errorf("Incorrect line %d:\nExp:%q\nGot:%q", i, line, lines[i])
+		}
+	}
+
+	// Dumping doesn't call read handlers or touch the bus state.
+	reads := 0
+	core.MapRead(0x2000, 0x2000, func(addr uint16) uint8 {
+		reads++
+		return 0x5A
+	})
+	lastRead := core.LastReadAddr()
+
+	if err = core.WriteMemoryDump(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	if reads != 0 || core.LastReadAddr() != lastRead {
+		t.Errorf("Dump had side effects: reads:%d last read:$%04X", reads, core.LastReadAddr())
+	}
+}
+
+func TestMemoryBinaryRoundTrip(t *testing.T) {
+	core, err := NewRWCore(romAt([]byte{OP_NOP}, 0x8000), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 0x8000; i++ {
+		core.PokeByte(uint16(i), uint8(i*7+i>>8))
+	}
+
+	buf := &bytes.Buffer{}
+	if err = core.WriteMemoryBinary(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.Len() != 0x10000 {
+		t.Fatalf("Incorrect image size: Exp:65536 Got:%d", buf.Len())
+	}
+	image := append([]byte{}, buf.Bytes()...)
+
+	other, err := NewRWCore(make([]byte, 0x10000), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = other.LoadMemoryBinary(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 0x10000; i++ {
+		if other.PeekByte(uint16(i)) != image[i] {
+			t.Fatalf("Incorrect value at $%04X: Exp:$%02X Got:$%02X",
+				i, image[i], other.PeekByte(uint16(i)))
+		}
+	}
+
+	err = other.LoadMemoryBinary(bytes.NewReader(image[:0x100]))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF for a short image, got %v", err)
+	}
+}
+
+func TestOverrideInstruction(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_NOP, OP_NOP}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sentinel := 0
+	core.OverrideInstruction(OP_NOP, StandardInstruction{
+		OpCode:      OP_NOP,
+		Instruction: "NOP",
+		AddressMode: ADDR_Implied,
+		Exec: func(c *Core, address uint16) {
+			sentinel++
+		},
+	})
+
+	if err = core.RunUntil(0x8002, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if sentinel != 2 {
+		t.Errorf("Incorrect sentinel value: Exp:2 Got:%d", sentinel)
+	}
+
+	// Other cores still use the default table.
+	other, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = other.Step(); err != nil {
+		t.Fatal(err)
+	}
+
+	if sentinel != 2 {
+		t.Errorf("Override leaked to another core")
+	}
+
+	core.OverrideInstruction(OP_NOP, nil)
+	core.PC = 0x8000
+	if err = core.Step(); !errors.Is(err, ErrUnimplementedOpcode) {
+		t.Errorf("Expected ErrUnimplementedOpcode, got %v", err)
+	}
+}
+
+func TestSetTrap(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_IM, 'O',
+		0x03,
+		OP_LDA_IM, 'K',
+		0x03,
+		0x13,
+		OP_LDA_IM, 0x00,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &strings.Builder{}
+	core.SetTrap(0x03, func(c *Core) bool {
+		fmt.Fprintf(out, "%c", c.A)
+		return false
+	})
+	core.SetTrap(0x13, func(c *Core) bool { return true })
+
+	if err = core.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !core.Halted() {
+		t.Errorf("Core did not halt")
+	}
+
+	if out.String() != "OK" {
+		t.Errorf("Incorrect output: Exp:%q Got:%q", "OK", out.String())
+	}
+
+	if core.PC != 0x8006 {
+		t.Errorf("Incorrect PC: Exp:$8006 Got:$%04X", core.PC)
+	}
+
+	if core.A != 'K' {
+		t.Errorf("Instruction after the halt was executed")
+	}
+}
+
+func TestWRAMBanks(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_IM, 0x11,
+		OP_STA_AB, 0x34, 0x72,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0, WRAMBanks(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = core.RunUntil(0x8005, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	core.SetWRAMBank(1)
+	if val := core.ReadByte(0x7234); val != 0x00 {
+		t.Errorf("Bank 1 has bank 0 data: Exp:$00 Got:$%02X", val)
+	}
+	core.WriteByte(0x7234, 0x22)
+
+	core.SetWRAMBank(0)
+	if val := core.ReadByte(0x7234); val != 0x11 {
+		t.Errorf("Incorrect bank 0 value: Exp:$11 Got:$%02X", val)
+	}
+
+	core.SetWRAMBank(1)
+	if val := core.ReadByte(0x7234); val != 0x22 {
+		t.Errorf("Incorrect bank 1 value: Exp:$22 Got:$%02X", val)
+	}
+
+	// Bank numbers wrap around.
+	core.SetWRAMBank(2)
+	if val := core.ReadByte(0x7234); val != 0x11 {
+		t.Errorf("Incorrect wrapped bank value: Exp:$11 Got:$%02X", val)
+	}
+}
+
+func TestROMBanks(t *testing.T) {
+	// Two 32k banks.  The second bank is mapped to $8000 by default.
+	rom := make([]byte, 0x10000)
+	rom[0x0000] = 0xB0
+	rom[0x7FFF] = 0xE0
+	rom[0x8000] = 0xB1
+	rom[0xFFFC] = 0x00
+	rom[0xFFFD] = 0x80
+	rom[0xFFFF] = 0xE1
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	core.SetROMBankHandler(0xFFF0, func(value uint8) {
+		core.SetROMBank(int(value), 0x8000)
+	})
+
+	tests := []struct {
+		bank  uint8
+		start uint8
+		end   uint8
+	}{
+		{1, 0xB1, 0xE1},
+		{0, 0xB0, 0xE0},
+		{1, 0xB1, 0xE1},
+	}
+
+	for _, tc := range tests {
+		core.WriteByte(0xFFF0, tc.bank)
+
+		if val := core.ReadByte(0x8000); val != tc.start {
+			t.Errorf("bank %d: Incorrect value at $8000: Exp:$%02X Got:$%02X", tc.bank, tc.start, val)
+		}
+
+		if val := core.ReadByte(0xFFFF); val != tc.end {
+			t.Errorf("bank %d: Incorrect value at $FFFF: Exp:$%02X Got:$%02X", tc.bank, tc.end, val)
+		}
+	}
+
+	// 16k banks put the following bank at $C000.
+	core.SetROMBank(1, 0x4000)
+	if val := core.ReadByte(0xBFFF); val != 0xE0 {
+		t.Errorf("Incorrect value at $BFFF: Exp:$E0 Got:$%02X", val)
+	}
+
+	if val := core.ReadByte(0xC000); val != 0xB1 {
+		t.Errorf("Incorrect value at $C000: Exp:$B1 Got:$%02X", val)
+	}
+}
+
+func TestFlagAccessors(t *testing.T) {
+	core := &Core{Phlags: FLAG_CARRY | FLAG_DECIMAL | FLAG_NEGATIVE}
+
+	tests := []struct {
+		name string
+		fn   func() bool
+		flag uint8
+		exp  bool
+	}{
+		{"Carry", core.Carry, FLAG_CARRY, true},
+		{"Zero", core.Zero, FLAG_ZERO, false},
+		{"Interrupt", core.Interrupt, FLAG_INTERRUPT, false},
+		{"Decimal", core.Decimal, FLAG_DECIMAL, true},
+		{"Overflow", core.Overflow, FLAG_OVERFLOW, false},
+		{"Negative", core.Negative, FLAG_NEGATIVE, true},
+	}
+
+	for _, tc := range tests {
+		if got := tc.fn(); got != tc.exp {
+			t.Errorf("%s: Exp:%t Got:%t", tc.name, tc.exp, got)
+		}
+
+		core.SetFlag(tc.flag, !tc.exp)
+		if got := tc.fn(); got != !tc.exp {
+			t.Errorf("%s after SetFlag: Exp:%t Got:%t", tc.name, !tc.exp, got)
+		}
+	}
+
+	exp := FLAG_ZERO | FLAG_INTERRUPT | FLAG_OVERFLOW
+	if core.Phlags != exp {
+		t.Errorf("Incorrect flags: Exp:%08b Got:%08b", exp, core.Phlags)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	core, err := NewCore(PadWithVectors([]byte{OP_NOP}, 0x8000, 0x8000, 0x8000), false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	core.memory[0x0300] = 0x34
+	core.memory[0x0301] = 0x12
+
+	reads := 0
+	core.MapRead(0x2000, 0x2000, func(addr uint16) uint8 {
+		reads++
+		return 0x55
+	})
+
+	core.ReadByte(0x0010)
+	if core.PeekByte(0x0300) != 0x34 || core.PeekWord(0x0300) != 0x1234 {
+		t.Errorf("Incorrect peek values")
+	}
+
+	if core.LastReadAddr() != 0x0010 {
+		t.Errorf("Peek changed the last read address: $%04X", core.LastReadAddr())
+	}
+
+	core.PeekByte(0x2000)
+	if reads != 0 {
+		t.Errorf("Peek called a read handler")
+	}
+
+	if core.ReadByte(0x0300) != 0x34 || core.LastReadAddr() != 0x0300 {
+		t.Errorf("ReadByte did not update the last read address")
+	}
+}
+
+func TestStackWrap(t *testing.T) {
+	core, err := NewCore(PadWithVectors([]byte{OP_NOP}, 0x8000, 0x8000, 0x8000), false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	core.SP = 0xFF
+	for i := 0; i < 256; i++ {
+		core.pushByte(uint8(i))
+		if addr := core.LastWriteAddr(); addr < 0x0100 || addr > 0x01FF {
+			t.Fatalf("push %d wrote outside the stack page: $%04X", i, addr)
+		}
+		if i == 255 && core.SP != 0xFF {
+			t.Errorf("SP did not wrap on overflow: $%02X", core.SP)
+		}
+	}
+
+	if core.memory[0x01FF] != 0x00 || core.memory[0x0100] != 0xFF {
+		t.Errorf("Incorrect stack contents: $01FF=$%02X $0100=$%02X", core.memory[0x01FF], core.memory[0x0100])
+	}
+
+	// Pushing once more overwrites the oldest entry.
+	core.pushByte(0xAA)
+	if core.memory[0x01FF] != 0xAA || core.SP != 0xFE {
+		t.Errorf("Incorrect wrapped push: $01FF=$%02X SP=$%02X", core.memory[0x01FF], core.SP)
+	}
+
+	core.SP = 0xFF
+	for i := 0; i < 256; i++ {
+		core.pullByte()
+		if addr := core.LastReadAddr(); addr < 0x0100 || addr > 0x01FF {
+			t.Fatalf("pull %d read outside the stack page: $%04X", i, addr)
+		}
+	}
+
+	if core.SP != 0xFF {
+		t.Errorf("SP did not wrap on underflow: $%02X", core.SP)
+	}
+}
+
+func TestStackGuard(t *testing.T) {
+	// Recurse forever.
+	rom := PadWithVectors([]byte{OP_JSR, 0x00, 0x80}, 0x8000, 0x8000, 0x8000)
+	core, err := NewCore(rom, false, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SP = 0xFF
+
+	overflows := 0
+	var depth uint64
+	core.StackGuard = func(c *Core, overflow bool) {
+		if !overflow {
+			t.Errorf("Unexpected underflow")
+		}
+		if overflows == 0 {
+			depth = c.ticks
+		}
+		overflows++
+	}
+
+	if err = core.Run(); !errors.Is(err, ErrInstructionLimit) {
+		t.Fatalf("Expected ErrInstructionLimit, got %v", err)
+	}
+
+	// Each JSR pushes two bytes, so the 128th call wraps the stack.
+	if overflows != 1 || depth != 128 {
+		t.Errorf("Incorrect overflow callbacks: %d at depth %d", overflows, depth)
+	}
+
+	underflows := 0
+	core.StackGuard = func(c *Core, overflow bool) {
+		if !overflow {
+			underflows++
+		}
+	}
+	core.SP = 0xFE
+	core.pullByte()
+	core.pullByte()
+	if underflows != 1 {
+		t.Errorf("Incorrect underflow callbacks: %d", underflows)
+	}
+}
+
+func TestStackHook(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_JSR, 0x04, 0x80,
+		OP_NOP, // $8003
+		OP_RTS, // $8004
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SP = 0xFD
+
+	events := []string{}
+	core.StackHook = func(c *Core, push bool, value uint8, sp uint8) {
+		op := "pull"
+		if push {
+			op = "push"
+		}
+		events = append(events, fmt.Sprintf("%s $%02X SP:$%02X", op, value, sp))
+	}
+
+	if err = core.RunUntil(0x8003, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// JSR pushes the address of its last byte, high byte first.
+	exp := []string{
+		"push $80 SP:$FC",
+		"push $02 SP:$FB",
+		"pull $02 SP:$FC",
+		"pull $80 SP:$FD",
+	}
+
+	if strings.Join(events, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("Incorrect stack events:\nExp:%q\nGot:%q", exp, events)
+	}
+}
+
+func TestReadWordWrap(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_NOP}, 0x8000, 0x8000, 0x8000)
+	rom[len(rom)-1] = 0x34 // $FFFF
+
+	rw, err := NewRWCore(romAt(rom, 0x8000), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw.rom[0xFFFF] = 0x34
+	rw.rom[0x0000] = 0x12
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.memory[0x0000] = 0x12
+
+	for name, c := range map[string]*Core{"fullRW": rw, "mapped": core} {
+		if val := c.ReadWord(0xFFFF); val != 0x1234 {
+			t.Errorf("%s: Incorrect word at $FFFF: Exp:$1234 Got:$%04X", name, val)
+		}
+
+		if val := c.PeekWord(0xFFFF); val != 0x1234 {
+			t.Errorf("%s: Incorrect peeked word at $FFFF: Exp:$1234 Got:$%04X", name, val)
+		}
+	}
+}
+
+// An instruction at $FFFE has its high operand byte at $0000, and the PC
+// wraps around to $0001 after it.
+func TestPCWrap(t *testing.T) {
+	mem := make([]byte, 0x10000)
+	mem[0xFFFE] = OP_LDA_AB
+	mem[0xFFFF] = 0x10
+	mem[0x0000] = 0x02
+	mem[0x0001] = OP_LDX_IM
+	mem[0x0002] = 0x07
+	mem[0x0210] = 0x5A
+
+	rw, err := NewRWCore(mem, 0, StartPC(0xFFFE), TrackCoverage())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rom := PadWithVectors([]byte{OP_NOP}, 0x8000, 0x8000, 0x8000)
+	rom[len(rom)-2] = OP_LDA_AB
+	rom[len(rom)-1] = 0x10
+
+	core, err := NewCore(rom, false, 0, StartPC(0xFFFE), TrackCoverage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(core.memory, mem[:0x1000])
+
+	for name, c := range map[string]*Core{"fullRW": rw, "mapped": core} {
+		c.Debug = true
+		c.DebugFile = ioutil.Discard
+
+		if asm, _ := c.Disassemble(0xFFFE); asm != "LDA $0210" {
+			t.Errorf("%s: Incorrect disassembly: Exp:%q Got:%q", name, "LDA $0210", asm)
+		}
+
+		if err = c.RunUntil(0x0003, 2); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if c.A != 0x5A || c.X != 0x07 {
+			t.Errorf("%s: Incorrect registers: Exp:A:$5A X:$07 Got:A:$%02X X:$%02X", name, c.A, c.X)
+		}
+
+		for _, addr := range []uint16{0xFFFE, 0xFFFF, 0x0000, 0x0001, 0x0002} {
+			if !c.Coverage()[addr] {
+				t.Errorf("%s: $%04X not covered", name, addr)
+			}
+		}
+	}
+}
+
+var dispatchSink Instruction
+
+// BenchmarkDispatch compares looking up the opcodes of a tight loop in a map
+// against the array used by decode.
+func BenchmarkDispatch(b *testing.B) {
+	loop := []byte{OP_LDA_ZP, OP_ADC_IM, OP_STA_ZP, OP_DEX, OP_BNE}
+
+	table := map[byte]Instruction{}
+	for op, instr := range instructionList {
+		if instr != nil {
+			table[byte(op)] = instr
+		}
+	}
+
+	b.Run("map", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			dispatchSink = table[loop[i%len(loop)]]
+		}
+	})
+
+	b.Run("array", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			dispatchSink = instructionList[loop[i%len(loop)]]
+		}
+	})
+}
+
+func TestOpcodeLengths(t *testing.T) {
+	for op := 0; op < 256; op++ {
+		for _, instr := range []Instruction{instructionList[op], illegalInstructionList[op]} {
+			if instr == nil {
+				continue
+			}
+
+			if l := instr.InstrLength(nil); opcodeLengths[op] != l {
+				t.Errorf("Incorrect cached length for $%02X: Exp:%d Got:%d", op, l, opcodeLengths[op])
+			}
+		}
+	}
+}
+
+// BenchmarkTraceReads reports the number of memory reads per instruction
+// in a tight loop with and without tracing.  The trace reuses the
+// instruction bytes captured at decode, so the only extra reads come from
+// formatting the operands.
+func BenchmarkTraceReads(b *testing.B) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_ZP, 0x10,
+		OP_ADC_IM, 0x01,
+		OP_STA_ZP, 0x10,
+		OP_DEX,
+		OP_JMP_AB, 0x00, 0x80,
+	}, 0x8000, 0x8000, 0x8000)
+
+	for _, traced := range []bool{false, true} {
+		name := "untraced"
+		if traced {
+			name = "traced"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			core, err := NewRWCore(romAt(rom, 0x8000), 0)
+			if err != nil {
+				b.Fatal(err)
+			}
+			core.Debug = traced
+			core.DebugFile = ioutil.Discard
+
+			reads := 0
+			core.MapRead(0x0000, 0xFFFF, func(addr uint16) uint8 {
+				reads++
+				return core.PeekByte(addr)
+			})
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err = core.Step(); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ReportMetric(float64(reads)/float64(b.N), "reads/instr")
+		})
+	}
+}
+
+// BenchmarkRun executes representative programs one instruction at a time
+// and reports instructions per second.  Each program loops forever.
+func BenchmarkRun(b *testing.B) {
+	workloads := []struct {
+		name string
+		prog []byte
+	}{
+		{"loop", []byte{
+			OP_LDX_IM, 0x00,
+			OP_DEX, // $8002
+			OP_BNE, 0xFD,
+			OP_JMP_AB, 0x00, 0x80,
+		}},
+
+		// Copy $0300-$03FF to $0400-$04FF.
+		{"memcpy", []byte{
+			OP_LDY_IM, 0x00,
+			OP_LDA_AY, 0x00, 0x03, // $8002
+			OP_STA_AY, 0x00, 0x04,
+			OP_INY,
+			OP_BNE, 0xF7,
+			OP_JMP_AB, 0x00, 0x80,
+		}},
+
+		{"mixed", []byte{
+			OP_LDA_ZP, 0x10,
+			OP_CLC,
+			OP_ADC_IM, 0x03,
+			OP_STA_ZP, 0x10,
+			OP_ASL_AC,
+			OP_PHA,
+			OP_INC_ZP, 0x11,
+			OP_LDX_ZP, 0x11,
+			OP_EOR_ZX, 0x20,
+			OP_PLA,
+			OP_CMP_IM, 0x40,
+			OP_JSR, 0x18, 0x80,
+			OP_JMP_AB, 0x00, 0x80,
+			OP_ROR_ZP, 0x12, // $8018
+			OP_BIT_ZP, 0x12,
+			OP_RTS,
+		}},
+	}
+
+	for _, w := range workloads {
+		rom := PadWithVectors(w.prog, 0x8000, 0x8000, 0x8000)
+		b.Run(w.name, func(b *testing.B) {
+			core, err := NewCore(rom, false, 0)
+			if err != nil {
+				b.Fatal(err)
+			}
+			core.SP = 0xFD
+			core.StuckThreshold = 0
+
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				if err = core.Step(); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "instr/s")
+		})
+	}
+}
+
+func TestNextInstruction(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_LDA_IM, 0x01, 0x02}, 0x8000, 0x8000, 0x8000)
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instr, ok := core.NextInstruction()
+	if !ok || instr.Name() != "LDA" || instr.AddressMeta().Name != ADDR_Immediate.Name {
+		t.Errorf("Incorrect instruction: %v %v", instr, ok)
+	}
+
+	if core.PC != 0x8000 || core.Ticks() != 0 {
+		t.Errorf("NextInstruction executed: PC:$%04X", core.PC)
+	}
+
+	if err = core.Step(); err != nil {
+		t.Fatal(err)
+	}
+
+	// $02 is a KIL opcode.
+	if instr, ok = core.NextInstruction(); ok || instr != nil {
+		t.Errorf("Expected no instruction, got %v", instr)
+	}
+
+	if core.PC != 0x8002 {
+		t.Errorf("NextInstruction moved the PC: $%04X", core.PC)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_NOP, OP_NOP}, 0x8000, 0x8000, 0x8000)
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	core.OverrideInstruction(OP_NOP, StandardInstruction{
+		OpCode:      OP_NOP,
+		Instruction: "NOP",
+		AddressMode: ADDR_Implied,
+		Exec: func(c *Core, address uint16) {
+			if c.PC == 0x8001 {
+				panic("boom")
+			}
+		},
+	})
+	core.A = 0x42
+
+	err = core.Run()
+	if !errors.Is(err, ErrPanic) {
+		t.Fatalf("Expected ErrPanic, got %v", err)
+	}
+
+	for _, s := range []string{"boom", "$8001", "opcode $EA", core.FormatRegisters()} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("Error is missing %q:\n%v", s, err)
+		}
+	}
+}
+
+func TestInstructionLimit(t *testing.T) {
+	// Three instructions, then the halt.
+	rom := PadWithVectors([]byte{OP_NOP, OP_NOP, OP_NOP, 0xFF}, 0x8000, 0x8000, 0x8000)
+
+	tests := []struct {
+		limit uint64
+		err   error
+		ticks uint64
+	}{
+		{0, nil, 4},
+		{4, nil, 4}, // halting on the last instruction is fine
+		{5, nil, 4},
+		{3, ErrInstructionLimit, 3},
+		{1, ErrInstructionLimit, 1},
+	}
+
+	for _, tc := range tests {
+		for _, testMode := range []bool{false, true} {
+			core, err := NewCore(rom, false, tc.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			core.SetTrap(0xFF, haltTrap)
+			core.testing = testMode
+
+			err = core.Run()
+			if !errors.Is(err, tc.err) {
+				t.Errorf("limit %d (testing: %t): Expected %v, got %v", tc.limit, testMode, tc.err, err)
+			}
+
+			if core.Ticks() != tc.ticks {
+				t.Errorf("limit %d (testing: %t): Incorrect ticks: Exp:%d Got:%d", tc.limit, testMode, tc.ticks, core.Ticks())
+			}
+
+			if core.InstructionLimit != tc.limit {
+				t.Errorf("limit %d: Run changed the limit to %d", tc.limit, core.InstructionLimit)
+			}
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package emu
+
+// Coverage returns a slice indexed by address that is true for every byte
+// that has been executed as part of an instruction, including operands.  It
+// is nil unless the core was created with TrackCoverage.  The returned slice
+// is live and will keep updating as the core runs.
+func (c *Core) Coverage() []bool {
+	return c.coverage
+}
+
+// OpcodeCounts returns the number of times each opcode has been executed.
+// Opcodes that haven't run are left out.  It is nil unless the core was
+// created with CountOpcodes.  The returned map is a copy.
+func (c *Core) OpcodeCounts() map[byte]uint64 {
+	if c.opcodeCounts == nil {
+		return nil
+	}
+
+	counts := make(map[byte]uint64, len(c.opcodeCounts))
+	for op, n := range c.opcodeCounts {
+		counts[op] = n
+	}
+	return counts
+}
+
+func (c *Core) markCovered(addr uint16, length uint8) {
+	for i := uint16(0); i < uint16(length); i++ {
+		c.coverage[addr+i] = true
+	}
+}
@@ -0,0 +1,83 @@
+package emu
+
+import (
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_IM, 0x00, // $8000
+		OP_BEQ, 0x02, // $8002
+		OP_LDA_IM, 0x01, // $8004, never executed
+		OP_LDX_IM, 0x02, // $8006
+		OP_JMP_AB, 0x08, 0x80, // $8008
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if core.Coverage() != nil {
+		t.Fatal("Coverage should be nil when not tracking")
+	}
+
+	core, err = NewCore(rom, false, 0, TrackCoverage())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = core.RunUntil(0x8008, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	cov := core.Coverage()
+	for addr := uint16(0x8000); addr < 0x8008; addr++ {
+		exp := addr < 0x8004 || addr >= 0x8006
+		if cov[addr] != exp {
+			t.Errorf("Incorrect coverage for $%04X: Exp:%t Got:%t", addr, exp, cov[addr])
+		}
+	}
+
+	if cov[0x8008] {
+		t.Errorf("$8008 should not be covered before it is executed")
+	}
+}
+
+func TestOpcodeCounts(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDX_IM, 0x05, // $8000
+		OP_INY,       // $8002
+		OP_DEX,       // $8003
+		OP_BNE, 0xFC, // $8004
+		0xFF, // $8006
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0, CountOpcodes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SetTrap(0xFF, haltTrap)
+
+	if err = core.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := map[byte]uint64{
+		OP_LDX_IM: 1,
+		OP_INY:    5,
+		OP_DEX:    5,
+		OP_BNE:    5,
+	}
+
+	counts := core.OpcodeCounts()
+	if len(counts) != len(exp) {
+		t.Errorf("Incorrect number of opcodes: Exp:%d Got:%d", len(exp), len(counts))
+	}
+
+	for op, n := range exp {
+		if counts[op] != n {
+			t.Errorf("Incorrect count for $%02X: Exp:%d Got:%d", op, n, counts[op])
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package emu
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Base cycle counts for each opcode on an NMOS 6502.  This does not include
+// the extra cycles for page crossing or taken branches; those are added by
+// each instruction's Cycles method.
+var opcodeCycles = [256]uint8{
+	//0 1  2  3  4  5  6  7  8  9  A  B  C  D  E  F
+	7, 6, 2, 8, 3, 3, 5, 5, 3, 2, 2, 2, 4, 4, 6, 6, // 0
+	2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // 1
+	6, 6, 2, 8, 3, 3, 5, 5, 4, 2, 2, 2, 4, 4, 6, 6, // 2
+	2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // 3
+	6, 6, 2, 8, 3, 3, 5, 5, 3, 2, 2, 2, 3, 4, 6, 6, // 4
+	2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // 5
+	6, 6, 2, 8, 3, 3, 5, 5, 4, 2, 2, 2, 5, 4, 6, 6, // 6
+	2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // 7
+	2, 6, 2, 6, 3, 3, 3, 3, 2, 2, 2, 2, 4, 4, 4, 4, // 8
+	2, 6, 2, 6, 4, 4, 4, 4, 2, 5, 2, 5, 5, 5, 5, 5, // 9
+	2, 6, 2, 6, 3, 3, 3, 3, 2, 2, 2, 2, 4, 4, 4, 4, // A
+	2, 5, 2, 5, 4, 4, 4, 4, 2, 4, 2, 4, 4, 4, 4, 4, // B
+	2, 6, 2, 8, 3, 3, 5, 5, 2, 2, 2, 2, 4, 4, 6, 6, // C
+	2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // D
+	2, 6, 2, 8, 3, 3, 5, 5, 2, 2, 2, 2, 4, 4, 6, 6, // E
+	2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // F
+}
+
+// baseCycles returns the base cycle count for opcode on the core's variant.
+func (c *Core) baseCycles(opcode byte) uint8 {
+	if c.variant == VariantWDC && wdcCycles[opcode] != 0 {
+		return wdcCycles[opcode]
+	}
+	if c.hasBitInstructions() && rockwellCycles[opcode] != 0 {
+		return rockwellCycles[opcode]
+	}
+	if c.variant != VariantNMOS && cmosCycles[opcode] != 0 {
+		return cmosCycles[opcode]
+	}
+	return opcodeCycles[opcode]
+}
+
+// pageCrossPenalty returns the extra cycle taken by a read using an indexed
+// mode when the index carries into the high byte.  Writes always take the
+// extra cycle, so it's already in their base count; reads are the opcodes
+// whose base count is the shorter one for their mode.
+func (c *Core) pageCrossPenalty(mode AddressModeMeta, base uint8) uint8 {
+	var addr uint16
+	var index uint8
+
+	switch mode.Name {
+	case ADDR_AbsoluteX.Name:
+		if base != 4 {
+			return 0
+		}
+		addr, index = c.PeekWord(c.PC+1), c.X
+	case ADDR_AbsoluteY.Name:
+		if base != 4 {
+			return 0
+		}
+		addr, index = c.PeekWord(c.PC+1), c.Y
+	case ADDR_IndirectY.Name:
+		if base != 5 {
+			return 0
+		}
+		zp := c.PeekByte(c.PC + 1)
+		addr = uint16(c.PeekByte(uint16(zp))) | uint16(c.PeekByte(uint16(zp+1)))<<8
+		index = c.Y
+	default:
+		return 0
+	}
+
+	if addr&0xFF00 != (addr+uint16(index))&0xFF00 {
+		return 1
+	}
+	return 0
+}
+
+// branchPenalty returns the extra cycles for a taken branch from the
+// instruction ending at next to target.
+func branchPenalty(next, target uint16) uint8 {
+	if next&0xFF00 != target&0xFF00 {
+		return 2
+	}
+	return 1
+}
+
+// addCycles counts n cycles, calling PerCycleHook once for each.
+func (c *Core) addCycles(n uint64) {
+	if c.PerCycleHook == nil {
+		c.cycles += n
+		return
+	}
+
+	for i := uint64(0); i < n; i++ {
+		c.cycles++
+		c.PerCycleHook(c.cycles)
+	}
+}
+
+// Cycles returns the total number of CPU cycles consumed so far.
+func (c Core) Cycles() uint64 {
+	return c.cycles
+}
+
+// ElapsedNanos converts the cycles consumed so far into the time they would
+// take on a CPU running at clockHz, in nanoseconds.  Zero is returned for a
+// clockHz of zero.
+func (c Core) ElapsedNanos(clockHz uint64) uint64 {
+	return cyclesToNanos(c.cycles, clockHz)
+}
+
+func cyclesToNanos(cycles, clockHz uint64) uint64 {
+	if clockHz == 0 {
+		return 0
+	}
+
+	// Use 128-bit math so long runs don't overflow the multiply.
+	hi, lo := bits.Mul64(cycles, 1e9)
+	if hi >= clockHz {
+		return math.MaxUint64
+	}
+
+	ns, _ := bits.Div64(hi, lo, clockHz)
+	return ns
+}
+
+// RunCycles executes whole instructions until at least budget cycles have
+// been consumed.  Instructions are never split, so the returned cycle count
+// may exceed the budget by up to the cost of the last instruction.
+func (c *Core) RunCycles(budget uint64) (uint64, error) {
+	start := c.cycles
+	for c.cycles-start < budget {
+		err := c.tick()
+		if err != nil {
+			return c.cycles - start, err
+		}
+
+		if c.halted {
+			break
+		}
+	}
+
+	return c.cycles - start, nil
+}
+
+// RunRealtime runs the core paced to clockHz using the cycle counts.  The
+// core runs in batches of about a millisecond of CPU time and sleeps until
+// the wall clock catches up after each one.  It returns when stop is closed,
+// a trap halts the core, or an error occurs.
+func (c *Core) RunRealtime(clockHz uint64, stop <-chan struct{}) error {
+	if clockHz == 0 {
+		return fmt.Errorf("Invalid clock rate: %d", clockHz)
+	}
+
+	batch := clockHz / 1000
+	if batch == 0 {
+		batch = 1
+	}
+
+	start := time.Now()
+	startCycles := c.cycles
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		if _, err := c.RunCycles(batch); err != nil {
+			return err
+		}
+
+		if c.halted {
+			return nil
+		}
+
+		// Time the CPU should have taken so far.
+		ns := cyclesToNanos(c.cycles-startCycles, clockHz)
+		if wait := time.Duration(ns) - time.Since(start); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+}
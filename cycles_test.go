@@ -0,0 +1,288 @@
+package emu
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunCycles(t *testing.T) {
+	// loop: NOP (2), INC $10 (5), JMP loop (3)
+	rom := PadWithVectors([]byte{
+		OP_NOP,
+		OP_INC_ZP, 0x10,
+		OP_JMP_AB, 0x00, 0x80,
+	}, 0x8000, 0x8000, 0x8000)
+	costs := []uint64{2, 5, 3}
+
+	for budget := uint64(1); budget <= 30; budget++ {
+		core, err := NewCore(rom, false, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Expected count is the first instruction boundary at or past the
+		// budget.
+		expected := uint64(0)
+		for i := 0; expected < budget; i++ {
+			expected += costs[i%len(costs)]
+		}
+
+		used, err := core.RunCycles(budget)
+		if err != nil {
+			t.Fatalf("budget %d: %v", budget, err)
+		}
+
+		if used != expected {
+			t.Errorf("budget %d: Incorrect cycles used: Exp:%d Got:%d", budget, expected, used)
+		}
+
+		if used != core.Cycles() {
+			t.Errorf("budget %d: Cycles() mismatch: Exp:%d Got:%d", budget, used, core.Cycles())
+		}
+	}
+}
+
+func TestPerCycleHook(t *testing.T) {
+	// LDA #$01 (2), STA $0200 (4), INX (2), NOP (2), then an NMI (7)
+	rom := PadWithVectors([]byte{
+		OP_LDA_IM, 0x01,
+		OP_STA_AB, 0x00, 0x02,
+		OP_INX,
+		OP_NOP,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := []uint64{}
+	core.PerCycleHook = func(cycle uint64) {
+		calls = append(calls, cycle)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err = core.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(calls) != 10 {
+		t.Fatalf("Incorrect number of calls: Exp:10 Got:%d", len(calls))
+	}
+
+	core.NMI()
+	if len(calls) != 17 {
+		t.Fatalf("Incorrect number of calls after NMI: Exp:17 Got:%d", len(calls))
+	}
+
+	for i, cycle := range calls {
+		if cycle != uint64(i+1) {
+			t.Errorf("Incorrect cycle for call %d: Exp:%d Got:%d", i, i+1, cycle)
+		}
+	}
+
+	if core.Cycles() != 17 {
+		t.Errorf("Incorrect cycle count: Exp:17 Got:%d", core.Cycles())
+	}
+}
+
+func TestRMWCycles(t *testing.T) {
+	tests := []struct {
+		opcode byte
+		cycles uint64
+	}{
+		{OP_ASL_ZP, 5}, {OP_ASL_ZX, 6}, {OP_ASL_AB, 6}, {OP_ASL_AX, 7},
+		{OP_LSR_ZP, 5}, {OP_LSR_ZX, 6}, {OP_LSR_AB, 6}, {OP_LSR_AX, 7},
+		{OP_ROL_ZP, 5}, {OP_ROL_ZX, 6}, {OP_ROL_AB, 6}, {OP_ROL_AX, 7},
+		{OP_ROR_ZP, 5}, {OP_ROR_ZX, 6}, {OP_ROR_AB, 6}, {OP_ROR_AX, 7},
+		{OP_INC_ZP, 5}, {OP_INC_ZX, 6}, {OP_INC_AB, 6}, {OP_INC_AX, 7},
+		{OP_DEC_ZP, 5}, {OP_DEC_ZX, 6}, {OP_DEC_AB, 6}, {OP_DEC_AX, 7},
+	}
+
+	for _, tc := range tests {
+		rom := PadWithVectors([]byte{tc.opcode, 0x10, 0x02}, 0x8000, 0x8000, 0x8000)
+		core, err := NewCore(rom, false, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = core.Step(); err != nil {
+			t.Fatalf("$%02X: %v", tc.opcode, err)
+		}
+
+		if core.Cycles() != tc.cycles {
+			t.Errorf("$%02X: Incorrect cycle count: Exp:%d Got:%d", tc.opcode, tc.cycles, core.Cycles())
+		}
+	}
+}
+
+func TestElapsedNanos(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_NOP,
+		OP_JMP_AB, 0x00, 0x80,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// NOP + JMP is five cycles, so this is exactly 1000.
+	if _, err = core.RunCycles(1000); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		clockHz uint64
+		nanos   uint64
+	}{
+		{1000000, 1000000}, // 1MHz, 1us per cycle
+		{1789773, 558730},  // NTSC NES
+		{2000000, 500000},  // 2MHz
+		{0, 0},
+	}
+
+	for _, tc := range tests {
+		if got := core.ElapsedNanos(tc.clockHz); got != tc.nanos {
+			t.Errorf("%dHz: Incorrect elapsed time: Exp:%d Got:%d", tc.clockHz, tc.nanos, got)
+		}
+	}
+
+	// Large cycle counts must not overflow.
+	core.cycles = 1 << 40
+	if got := core.ElapsedNanos(1000000); got != (1<<40)*1000 {
+		t.Errorf("Incorrect elapsed time for a long run: Exp:%d Got:%d", uint64(1<<40)*1000, got)
+	}
+}
+
+func TestRunRealtime(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDX_IM, 0x00,
+		OP_DEX,
+		OP_BNE, 0xFD,
+		0x03,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SetTrap(0x03, haltTrap)
+
+	// About 1000 cycles at 20kHz is around 50ms.
+	const clockHz = 20000
+	start := time.Now()
+	if err = core.RunRealtime(clockHz, nil); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+
+	exp := time.Duration(core.ElapsedNanos(clockHz))
+	if elapsed < exp*8/10 || elapsed > exp+500*time.Millisecond {
+		t.Errorf("Incorrect wall time: Exp:~%s Got:%s", exp, elapsed)
+	}
+
+	// An endless loop stops when the channel is closed.
+	rom = PadWithVectors([]byte{OP_JMP_AB, 0x00, 0x80}, 0x8000, 0x8000, 0x8000)
+	core, err = NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(stop)
+	}()
+
+	if err = core.RunRealtime(clockHz, stop); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.Cycles() == 0 {
+		t.Errorf("Core did not run")
+	}
+}
+
+func TestInstructionCycles(t *testing.T) {
+	setX := func(x uint8) func(c *Core) { return func(c *Core) { c.X = x } }
+	setY := func(y uint8) func(c *Core) {
+		return func(c *Core) {
+			c.Y = y
+			c.memory[0x10] = 0xF0 // $02F0
+			c.memory[0x11] = 0x02
+		}
+	}
+	zero := func(c *Core) { c.Phlags = FLAG_ZERO }
+
+	tests := []struct {
+		name    string
+		prog    []byte
+		setup   func(c *Core)
+		variant Variant
+		cycles  uint8
+	}{
+		{"implied", []byte{OP_NOP}, nil, VariantNMOS, 2},
+		{"immediate", []byte{OP_LDA_IM, 0x01}, nil, VariantNMOS, 2},
+		{"zero page", []byte{OP_LDA_ZP, 0x10}, nil, VariantNMOS, 3},
+		{"zero page,X", []byte{OP_LDA_ZX, 0x10}, setX(0xFF), VariantNMOS, 4},
+		{"absolute", []byte{OP_LDA_AB, 0x00, 0x02}, nil, VariantNMOS, 4},
+		{"absolute,X", []byte{OP_LDA_AX, 0x00, 0x02}, setX(0xFF), VariantNMOS, 4},
+		{"absolute,X cross", []byte{OP_LDA_AX, 0x01, 0x02}, setX(0xFF), VariantNMOS, 5},
+		{"absolute,Y", []byte{OP_LDA_AY, 0x00, 0x02}, setY(0x0F), VariantNMOS, 4},
+		{"absolute,Y cross", []byte{OP_LDA_AY, 0xF1, 0x02}, setY(0x0F), VariantNMOS, 5},
+		{"(indirect,X)", []byte{OP_LDA_IX, 0x10}, nil, VariantNMOS, 6},
+		{"(indirect),Y", []byte{OP_LDA_IY, 0x10}, setY(0x0F), VariantNMOS, 5},
+		{"(indirect),Y cross", []byte{OP_LDA_IY, 0x10}, setY(0x10), VariantNMOS, 6},
+		{"store absolute,X", []byte{OP_STA_AX, 0x00, 0x02}, setX(0x01), VariantNMOS, 5},
+		{"store absolute,X cross", []byte{OP_STA_AX, 0xFF, 0x02}, setX(0x01), VariantNMOS, 5},
+		{"store (indirect),Y cross", []byte{OP_STA_IY, 0x10}, setY(0x10), VariantNMOS, 6},
+		{"illegal read cross", []byte{OP_LAX_AY, 0xF1, 0x02}, setY(0x0F), VariantNMOS, 5},
+		{"accumulator", []byte{OP_ASL_AC}, nil, VariantNMOS, 2},
+		{"RMW absolute,X", []byte{OP_ASL_AX, 0x00, 0x02}, setX(0x01), VariantNMOS, 7},
+		{"RMW absolute,X cross", []byte{OP_ASL_AX, 0xFF, 0x02}, setX(0x01), VariantNMOS, 7},
+		{"branch not taken", []byte{OP_BEQ, 0x10}, nil, VariantNMOS, 2},
+		{"branch taken", []byte{OP_BEQ, 0x10}, zero, VariantNMOS, 3},
+		{"branch taken cross", []byte{OP_BEQ, 0x80}, zero, VariantNMOS, 4},
+		{"JMP absolute", []byte{OP_JMP_AB, 0x00, 0x80}, nil, VariantNMOS, 3},
+		{"JMP indirect", []byte{OP_JMP_ID, 0x00, 0x02}, nil, VariantNMOS, 5},
+		{"JMP indirect 65C02", []byte{OP_JMP_ID, 0x00, 0x02}, nil, Variant65C02, 6},
+		{"JSR", []byte{OP_JSR, 0x00, 0x80}, nil, VariantNMOS, 6},
+		{"(zero page) 65C02", []byte{OP_LDA_IZ, 0x10}, nil, Variant65C02, 5},
+		{"BBR not taken", []byte{OP_BBR0, 0x10, 0x10}, func(c *Core) { c.memory[0x10] = 0x01 }, VariantRockwell, 5},
+		{"BBR taken", []byte{OP_BBR0, 0x10, 0x10}, nil, VariantRockwell, 6},
+		{"BBR taken cross", []byte{OP_BBR0, 0x10, 0x80}, nil, VariantRockwell, 7},
+	}
+
+	for _, tc := range tests {
+		rom := PadWithVectors(tc.prog, 0x8000, 0x8000, 0x8000)
+		core, err := NewCore(rom, false, 0, CPUVariant(tc.variant))
+		if err != nil {
+			t.Fatal(err)
+		}
+		core.SetAllowIllegal(true)
+		core.SP = 0xFD
+
+		if tc.setup != nil {
+			tc.setup(core)
+		}
+
+		instr, ok := core.NextInstruction()
+		if !ok {
+			t.Fatalf("%s: Instruction not decoded", tc.name)
+		}
+
+		if got := instr.Cycles(core); got != tc.cycles {
+			t.Errorf("%s: Incorrect Cycles(): Exp:%d Got:%d", tc.name, tc.cycles, got)
+		}
+
+		if err = core.Step(); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		if core.Cycles() != uint64(tc.cycles) {
+			t.Errorf("%s: Incorrect cycles counted: Exp:%d Got:%d", tc.name, tc.cycles, core.Cycles())
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package emu
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Disassemble returns the assembly for the instruction at addr and its
+// length in bytes.  Opcodes that aren't implemented are returned as a single
+// .byte directive.
+func (c *Core) Disassemble(addr uint16) (string, uint8) {
+	opcode := c.ReadByte(addr)
+	instr, ok := c.decode(opcode)
+	if !ok {
+		return fmt.Sprintf(".byte $%02X", opcode), 1
+	}
+
+	asm := instr.Name() + " " + instr.AddressMeta().Asm(c, addr)
+	return strings.TrimSpace(asm), c.instrLength(opcode, instr)
+}
+
+// DisasmOptions controls the output of DisassembleRange.
+type DisasmOptions struct {
+	// ResolveTargets adds the absolute target of branches, JMP, and JSR as
+	// a comment, using the label for the target if there is one.
+	ResolveTargets bool
+
+	// LabelVectors labels the NMI, RESET, and IRQ handlers and shows the
+	// vectors at $FFFA-$FFFF as data.
+	LabelVectors bool
+
+	// Labels names addresses in the listing.
+	Labels map[uint16]string
+}
+
+// DisasmLine is a single line of a listing from DisassembleRange.
+type DisasmLine struct {
+	Addr    uint16
+	Bytes   []byte
+	Label   string
+	Asm     string
+	Comment string
+}
+
+func (l DisasmLine) String() string {
+	ops := []string{}
+	for _, b := range l.Bytes {
+		ops = append(ops, fmt.Sprintf("%02X", b))
+	}
+
+	line := fmt.Sprintf("$%04X: %-9s %s", l.Addr, strings.Join(ops, " "), l.Asm)
+	if l.Comment != "" {
+		line += " ; " + l.Comment
+	}
+
+	if l.Label != "" {
+		return l.Label + ":\n" + line
+	}
+	return line
+}
+
+var vectorNames = []struct {
+	addr uint16
+	name string
+}{
+	{VECTOR_NMI, "NMI"},
+	{VECTOR_RESET, "RESET"},
+	{VECTOR_IRQ, "IRQ"},
+}
+
+// DisassembleRange disassembles every instruction starting between start
+// and end, inclusive.
+func (c *Core) DisassembleRange(start, end uint16, opts DisasmOptions) []DisasmLine {
+	labels := map[uint16]string{}
+	vectors := map[uint16]string{}
+	if opts.LabelVectors {
+		for _, v := range vectorNames {
+			labels[c.ReadWord(v.addr)] = v.name
+			vectors[v.addr] = v.name
+		}
+	}
+
+	// User labels win over the vector names.
+	for addr, name := range opts.Labels {
+		labels[addr] = name
+	}
+
+	lines := []DisasmLine{}
+
+	// Count with an int so an end of $FFFF doesn't wrap forever.
+	for i := int(start); i <= int(end); {
+		addr := uint16(i)
+		line := DisasmLine{Addr: addr, Label: labels[addr]}
+
+		var length uint8
+		if name, ok := vectors[addr]; ok {
+			line.Asm = fmt.Sprintf(".word $%04X", c.ReadWord(addr))
+			line.Comment = name
+			length = 2
+		} else {
+			line.Asm, length = c.Disassemble(addr)
+			if opts.ResolveTargets {
+				if target, ok := c.branchTarget(addr); ok {
+					name, ok := labels[target]
+					if !ok {
+						name = fmt.Sprintf("$%04X", target)
+					}
+					line.Comment = "-> " + name
+				}
+			}
+		}
+
+		for j := uint16(0); j < uint16(length); j++ {
+			line.Bytes = append(line.Bytes, c.ReadByte(addr+j))
+		}
+
+		lines = append(lines, line)
+		i += int(length)
+	}
+
+	return lines
+}
+
+// branchTarget returns the address a branch, JMP, or JSR at addr can
+// transfer control to.  Memory is read with PeekByte, so finding the target
+// has no side effects.
+func (c *Core) branchTarget(addr uint16) (uint16, bool) {
+	instr, ok := c.decode(c.PeekByte(addr))
+	if !ok {
+		return 0, false
+	}
+
+	switch instr.(type) {
+	case Branch:
+		return c.addrRelative(addr, c.PeekByte(addr+1)), true
+	case BitBranch:
+		return c.addrRelative(addr+1, c.PeekByte(addr+2)), true
+	case Jump:
+		switch instr.AddressMeta().Name {
+		case ADDR_Absolute.Name:
+			return c.PeekWord(addr + 1), true
+		case ADDR_Indirect.Name:
+			return c.peekIndirect(c.PeekWord(addr + 1)), true
+		}
+	}
+	return 0, false
+}
+
+// RegionKind classifies a Region found by ScanRegions.
+type RegionKind int
+
+const (
+	RegionData RegionKind = iota // not reachable from an entry point
+	RegionCode                   // reachable instruction bytes
+)
+
+func (k RegionKind) String() string {
+	if k == RegionCode {
+		return "code"
+	}
+	return "data"
+}
+
+// Region is an inclusive range of addresses with a single classification.
+type Region struct {
+	Start uint16
+	End   uint16
+	Kind  RegionKind
+}
+
+// ScanRegions splits start through end, inclusive, into code and data.
+// Execution is followed from each entry point through branches, JMP, and
+// JSR, and every byte of an instruction reached this way is code.
+// Everything else is data.  Flow stops at JMP, RTS, RTI, BRK, opcodes that
+// aren't implemented, and addresses outside the range.  If no entry points
+// are given, start is used.  Memory is read with PeekByte, so read handlers
+// aren't called and the core's state is left untouched.
+func (c *Core) ScanRegions(start, end uint16, entries ...uint16) []Region {
+	if len(entries) == 0 {
+		entries = []uint16{start}
+	}
+
+	code := make([]bool, int(end)-int(start)+1)
+	inRange := func(addr uint16) bool {
+		return addr >= start && addr <= end
+	}
+
+	queue := append([]uint16{}, entries...)
+	for len(queue) > 0 {
+		addr := queue[0]
+		queue = queue[1:]
+
+		for inRange(addr) && !code[addr-start] {
+			opcode := c.PeekByte(addr)
+			instr, ok := c.decode(opcode)
+			if !ok {
+				break
+			}
+
+			length := c.instrLength(opcode, instr)
+			for i := uint16(0); i < uint16(length) && inRange(addr+i); i++ {
+				code[addr+i-start] = true
+			}
+
+			if target, ok := c.branchTarget(addr); ok {
+				queue = append(queue, target)
+			}
+
+			if stopsFlow(instr) {
+				break
+			}
+			addr += uint16(length)
+		}
+	}
+
+	regions := []Region{}
+	for i := range code {
+		kind := RegionData
+		if code[i] {
+			kind = RegionCode
+		}
+
+		addr := start + uint16(i)
+		if n := len(regions); n > 0 && regions[n-1].Kind == kind {
+			regions[n-1].End = addr
+			continue
+		}
+		regions = append(regions, Region{Start: addr, End: addr, Kind: kind})
+	}
+
+	return regions
+}
+
+// stopsFlow returns true if execution never continues with the instruction
+// following instr.
+func stopsFlow(instr Instruction) bool {
+	switch instr.Name() {
+	case "JMP", "RTS", "RTI", "BRK":
+		return true
+	}
+	return false
+}
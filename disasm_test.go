@@ -0,0 +1,284 @@
+package emu
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDisassembleBIT(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_BIT_ZP, 0x44,
+		OP_BIT_AB, 0x44, 0x00,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr   uint16
+		asm    string
+		length uint8
+	}{
+		{0x8000, "BIT $44", 2},
+		{0x8002, "BIT $0044", 3},
+		{0x8005, ".byte $FF", 1},
+	}
+
+	for _, tc := range tests {
+		asm, length := core.Disassemble(tc.addr)
+		if asm != tc.asm {
+			t.Errorf("$%04X: Incorrect disassembly: Exp:%q Got:%q", tc.addr, tc.asm, asm)
+		}
+
+		if length != tc.length {
+			t.Errorf("$%04X: Incorrect length: Exp:%d Got:%d", tc.addr, tc.length, length)
+		}
+	}
+
+	// The trace should show the operand address, not the value at it.
+	buf := &bytes.Buffer{}
+	core.DebugFile = buf
+	core.Debug = true
+	core.memory[0x44] = 0x99
+
+	for i := 0; i < 2; i++ {
+		if err = core.tick(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := strings.Split(buf.String(), "\n")
+	if !strings.Contains(lines[0], "BIT $44 ") {
+		t.Errorf("Incorrect zero page trace: %q", lines[0])
+	}
+
+	if !strings.Contains(lines[1], "BIT $0044 ") {
+		t.Errorf("Incorrect absolute trace: %q", lines[1])
+	}
+}
+
+// Accumulator and implied instructions have no operand bytes, so nothing
+// from the following bytes should end up in the output.
+func TestDisassembleNoOperand(t *testing.T) {
+	tests := []struct {
+		opcode byte
+		asm    string
+	}{
+		{OP_ASL_AC, "ASL A"},
+		{OP_LSR_AC, "LSR A"},
+		{OP_ROL_AC, "ROL A"},
+		{OP_ROR_AC, "ROR A"},
+		{OP_INX, "INX"},
+		{OP_CLC, "CLC"},
+		{OP_PHA, "PHA"},
+		{OP_NOP, "NOP"},
+	}
+
+	program := []byte{}
+	for _, tc := range tests {
+		program = append(program, tc.opcode)
+	}
+
+	core, err := NewCore(PadWithVectors(program, 0x8000, 0x8000, 0x8000), false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	core.DebugFile = buf
+	core.Debug = true
+
+	for i, tc := range tests {
+		addr := 0x8000 + uint16(i)
+		asm, length := core.Disassemble(addr)
+		if asm != tc.asm {
+			t.Errorf("$%04X: Incorrect disassembly: Exp:%q Got:%q", addr, tc.asm, asm)
+		}
+
+		if length != 1 {
+			t.Errorf("$%04X: Incorrect length: Exp:1 Got:%d", addr, length)
+		}
+
+		if err = core.tick(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// In the trace the operand column is followed by the registers, which
+	// start with "A:".
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	for i, tc := range tests {
+		parts := strings.SplitN(tc.asm, " ", 2)
+		idx := strings.Index(lines[i], " "+parts[0]+" ")
+		if idx < 0 {
+			t.Errorf("%s missing from trace: %q", parts[0], lines[i])
+			continue
+		}
+
+		exp := "A:"
+		if len(parts) == 2 {
+			exp = parts[1]
+		}
+
+		fields := strings.Fields(lines[i][idx+len(parts[0])+1:])
+		if fields[0] != exp {
+			t.Errorf("Incorrect %s operand in trace: Exp:%q Got:%q", parts[0], exp, fields[0])
+		}
+	}
+}
+
+func TestDisassembleRange(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDX_IM, 0x05, // $8000
+		OP_DEX,       // $8002
+		OP_BNE, 0xFD, // $8003
+		OP_JSR, 0x0A, 0x80, // $8005
+		OP_JMP_AB, 0x00, 0x80, // $8008
+	}, 0x9000, 0x8000, 0x9000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := core.DisassembleRange(0x8000, 0x800A, DisasmOptions{
+		ResolveTargets: true,
+		LabelVectors:   true,
+		Labels:         map[uint16]string{0x8002: "loop"},
+	})
+
+	if len(lines) != 5 {
+		t.Fatalf("Incorrect line count: Exp:5 Got:%d", len(lines))
+	}
+
+	if lines[0].Label != "RESET" {
+		t.Errorf("Reset handler not labeled: %q", lines[0].Label)
+	}
+
+	if lines[1].Label != "loop" {
+		t.Errorf("User label missing: %q", lines[1].Label)
+	}
+
+	tests := []struct {
+		idx     int
+		comment string
+	}{
+		{0, ""},
+		{2, "-> loop"},
+		{3, "-> $800A"},
+		{4, "-> RESET"},
+	}
+
+	for _, tc := range tests {
+		if lines[tc.idx].Comment != tc.comment {
+			t.Errorf("$%04X: Incorrect comment: Exp:%q Got:%q", lines[tc.idx].Addr, tc.comment, lines[tc.idx].Comment)
+		}
+	}
+
+	expLine := "$8003: D0 FD     BNE $8002   (-3) ; -> loop"
+	if lines[2].String() != expLine {
+		t.Errorf("Incorrect line:\nExp:%q\nGot:%q", expLine, lines[2].String())
+	}
+
+	lines = core.DisassembleRange(0xFFFA, 0xFFFF, DisasmOptions{LabelVectors: true})
+	expVectors := []string{
+		"$FFFA: 00 90     .word $9000 ; NMI",
+		"$FFFC: 00 80     .word $8000 ; RESET",
+		"$FFFE: 00 90     .word $9000 ; IRQ",
+	}
+
+	if len(lines) != len(expVectors) {
+		t.Fatalf("Incorrect vector line count: Exp:%d Got:%d", len(expVectors), len(lines))
+	}
+
+	for i, exp := range expVectors {
+		if lines[i].String() != exp {
+			t.Errorf("Incorrect vector line:\nExp:%q\nGot:%q", exp, lines[i].String())
+		}
+	}
+}
+
+func TestScanRegions(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_JSR, 0x0A, 0x80, // $8000
+		OP_JMP_AB, 0x12, 0x80, // $8003
+
+		// Data table at $8006 that would decode as LDA #$20; JMP $xx60
+		0xA9, 0x20, 0x4C, 0x60,
+
+		OP_LDA_AX, 0x06, 0x80, // $800A
+		OP_BNE, 0x02, // $800D
+		OP_LDX_IM, 0x00, // $800F
+		OP_RTS,                // $8011
+		OP_JMP_AB, 0x12, 0x80, // $8012
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []Region{
+		{0x8000, 0x8005, RegionCode},
+		{0x8006, 0x8009, RegionData},
+		{0x800A, 0x8014, RegionCode},
+		{0x8015, 0x8020, RegionData},
+	}
+
+	got := core.ScanRegions(0x8000, 0x8020)
+	if len(got) != len(exp) {
+		t.Fatalf("Incorrect regions:\nExp:%v\nGot:%v", exp, got)
+	}
+
+	for i := range exp {
+		if got[i] != exp[i] {
+			t.Errorf("Incorrect region %d: Exp:%v Got:%v", i, exp[i], got[i])
+		}
+	}
+
+	// A range ending at $FFFF doesn't wrap.
+	got = core.ScanRegions(0xFFF0, 0xFFFF)
+	if len(got) != 1 || got[0] != (Region{0xFFF0, 0xFFFF, RegionData}) {
+		t.Errorf("Incorrect regions at the end of memory: %v", got)
+	}
+}
+
+// Scanning is static, so it must not call read handlers or change the state
+// used by the stuck detector.
+func TestScanRegionsNoSideEffects(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_AB, 0x00, 0x20, // $8000
+		OP_BEQ, 0x03, // $8003
+		OP_JMP_ID, 0x00, 0x20, // $8005
+		OP_RTS, // $8008
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reads := 0
+	core.MapRead(0x2000, 0x2001, func(addr uint16) uint8 {
+		reads++
+		return 0x80
+	})
+	core.MapRead(0x8000, 0x80FF, func(addr uint16) uint8 {
+		reads++
+		return OP_NOP
+	})
+
+	lastRead := core.LastReadAddr()
+	core.ScanRegions(0x8000, 0x8010)
+	if reads != 0 {
+		t.Errorf("Scan called read handlers %d times", reads)
+	}
+
+	if core.LastReadAddr() != lastRead || core.readRegister {
+		t.Errorf("Scan changed the read state: last read $%04X, register %t",
+			core.LastReadAddr(), core.readRegister)
+	}
+}
@@ -0,0 +1,53 @@
+//go:build functional
+// +build functional
+
+package emu
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// Klaus Dormann's 6502 functional test.  Run with:
+//
+//	go test -tags functional -run TestFunctional
+//
+// The assembled binary is expected at cmd/6502_functional_test.bin.  The
+// binary in the repository was built with its code segment at $8000, so
+// execution starts there and the success trap is at $B069.  The default
+// build from the upstream repository starts at $0400 with the success trap
+// at $3469; adjust the constants below if using that build instead.
+const (
+	functionalBinary  = "cmd/6502_functional_test.bin"
+	functionalStart   = 0x8000
+	functionalSuccess = 0xB069
+)
+
+func TestFunctional(t *testing.T) {
+	rom, err := ioutil.ReadFile(functionalBinary)
+	if os.IsNotExist(err) {
+		t.Skipf("%s not found", functionalBinary)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	core, err := NewRWCore(rom, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.PC = functionalStart
+
+	// Every trap in the test is a JMP to itself, including the success
+	// trap, so the run always ends with the stuck detector.
+	err = core.Run()
+	if !errors.Is(err, ErrStuck) {
+		t.Fatalf("Unexpected error at $%04X: %v", core.PC, err)
+	}
+
+	if core.PC != functionalSuccess {
+		t.Errorf("Trapped at $%04X after %d instructions", core.PC, core.Ticks())
+		core.DumpRegisters()
+	}
+}
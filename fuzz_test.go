@@ -0,0 +1,64 @@
+//go:build go1.18
+// +build go1.18
+
+package emu
+
+import (
+	"errors"
+	"testing"
+)
+
+// FuzzDecode runs arbitrary bytes as a program.  The first byte picks the
+// CPU variant, the next two are the start address, and the rest is copied
+// to memory from there, wrapping at $FFFF.  Bad programs may return any
+// error, but must never panic.
+func FuzzDecode(f *testing.F) {
+	seeds := [][]byte{
+		// Operand read past $FFFF.
+		{0, 0xFE, 0xFF, OP_LDA_AB, 0x34},
+		// JMP ($xxFF) page bug.
+		{0, 0x00, 0x80, OP_JMP_ID, 0xFF, 0x10},
+		// JSR with the stack wrapping.
+		{0, 0x00, 0x80, OP_JSR, 0x00, 0x80},
+		// BRK through an empty vector.
+		{0, 0x00, 0x80, OP_BRK, 0x00},
+		// KIL.
+		{0, 0x00, 0x80, 0x02},
+		// Branch backwards over $0000.
+		{0, 0x02, 0x00, OP_BNE, 0xF0},
+		// Rockwell BBS at the end of memory.
+		{2, 0xFD, 0xFF, OP_BBS0, 0xFF, 0xFD},
+		// 65C02 (zp) with the pointer at $FF.
+		{1, 0x00, 0x80, OP_LDA_IZ, 0xFF},
+	}
+	for _, s := range seeds {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) < 3 {
+			return
+		}
+
+		variants := []Variant{VariantNMOS, Variant65C02, VariantRockwell, VariantWDC}
+		variant := variants[int(data[0])%len(variants)]
+		start := uint16(data[1]) | uint16(data[2])<<8
+
+		image := make([]byte, 0x10000)
+		for i, b := range data[3:] {
+			image[start+uint16(i)] = b
+		}
+
+		core, err := NewRWCore(image, 1000, CPUVariant(variant), StartPC(start))
+		if err != nil {
+			t.Fatal(err)
+		}
+		core.SetAllowIllegal(true)
+		core.StuckThreshold = 1
+
+		err = core.Run()
+		if errors.Is(err, ErrPanic) {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package emu
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// Number of lines shown before a divergence in AssertTrace.
+const traceContext = 3
+
+// AssertTrace runs rom until it executes a $FF opcode and compares the text
+// trace line by line against golden.  The stack pointer starts at $FD, as it
+// is after a reset.  The first line that differs is reported along with the
+// lines leading up to it.
+func AssertTrace(t *testing.T, rom []byte, golden []byte) {
+	t.Helper()
+
+	core, err := NewCore(rom, false, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SetTrap(0xFF, haltTrap)
+	core.SP = 0xFD
+
+	buf := &bytes.Buffer{}
+	core.Debug = true
+	core.DebugFile = buf
+
+	runErr := core.Run()
+
+	got := traceLines(buf.Bytes())
+	exp := traceLines(golden)
+
+	for i := 0; i < len(exp) || i < len(got); i++ {
+		var e, g string
+		if i < len(exp) {
+			e = exp[i]
+		}
+		if i < len(got) {
+			g = got[i]
+		}
+
+		if e == g {
+			continue
+		}
+
+		start := i - traceContext
+		if start < 0 {
+			start = 0
+		}
+
+		t.Errorf("Trace diverges at line %d:\n%s\nExp: %s\nGot: %s",
+			i+1, strings.Join(exp[start:i], "\n"), e, g)
+		break
+	}
+
+	if runErr != nil {
+		t.Errorf("Run error: %v", runErr)
+	}
+}
+
+func traceLines(data []byte) []string {
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \r")
+	}
+	return lines
+}
+
+func TestGoldenTrace(t *testing.T) {
+	golden, err := ioutil.ReadFile("testdata/countdown.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	AssertTrace(t, goldenROM(), golden)
+}
+
+// goldenROM counts X down from 3 while pushing each value, then calls a
+// subroutine that stores A.
+func goldenROM() []byte {
+	return PadWithVectors([]byte{
+		OP_LDX_IM, 0x03, // $8000
+		OP_TXA,       // $8002
+		OP_PHA,       // $8003
+		OP_DEX,       // $8004
+		OP_BNE, 0xFB, // $8005
+		OP_JSR, 0x0B, 0x80, // $8007
+		0xFF,            // $800A
+		OP_STA_ZP, 0x10, // $800B
+		OP_RTS, // $800D
+	}, 0x8000, 0x8000, 0x8000)
+}
@@ -0,0 +1,136 @@
+package emu
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Flag bits 4 and 5 don't exist in the status register, so they are
+// ignored when comparing against the test data.
+const hartePhlagsMask uint8 = 0xCF
+
+type harteState struct {
+	PC  uint16   `json:"pc"`
+	S   uint8    `json:"s"`
+	A   uint8    `json:"a"`
+	X   uint8    `json:"x"`
+	Y   uint8    `json:"y"`
+	P   uint8    `json:"p"`
+	RAM [][2]int `json:"ram"`
+}
+
+type harteCase struct {
+	Name    string     `json:"name"`
+	Initial harteState `json:"initial"`
+	Final   harteState `json:"final"`
+}
+
+// RunHarteTest runs the test cases in data, which is in the format of the
+// per-opcode JSON files from the SingleStepTests (formerly ProcessorTests)
+// project.  Each case is loaded into a full 64k RW core, a single
+// instruction is executed, and the registers and RAM are compared against
+// the final state.
+func RunHarteTest(t *testing.T, data []byte) {
+	t.Helper()
+
+	cases := []harteCase{}
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatalf("Unable to parse test data: %v", err)
+	}
+
+	for _, hc := range cases {
+		t.Run(hc.Name, func(t *testing.T) {
+			core, err := NewRWCore(make([]byte, 0x10000), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			core.StuckThreshold = 0
+
+			core.SetRegisters(Registers{
+				A:      hc.Initial.A,
+				X:      hc.Initial.X,
+				Y:      hc.Initial.Y,
+				PC:     hc.Initial.PC,
+				Phlags: hc.Initial.P,
+				SP:     hc.Initial.S,
+			})
+
+			for _, m := range hc.Initial.RAM {
+				core.WriteByte(uint16(m[0]), uint8(m[1]))
+			}
+
+			if err = core.tick(); err != nil {
+				t.Fatal(err)
+			}
+
+			exp := Registers{
+				A:      hc.Final.A,
+				X:      hc.Final.X,
+				Y:      hc.Final.Y,
+				PC:     hc.Final.PC,
+				Phlags: hc.Final.P & hartePhlagsMask,
+				SP:     hc.Final.S,
+			}
+
+			got := core.Registers()
+			got.Phlags &= hartePhlagsMask
+			if got != exp {
+				t.Errorf("Incorrect registers:\nExp:%+v\nGot:%+v", exp, got)
+			}
+
+			for _, m := range hc.Final.RAM {
+				if val := core.ReadByte(uint16(m[0])); val != uint8(m[1]) {
+					t.Errorf("Incorrect memory value at $%04X: Exp:$%02X Got:$%02X", m[0], m[1], val)
+				}
+			}
+		})
+	}
+}
+
+const harteSample = `[
+	{
+		"name": "a9 80",
+		"initial": {"pc": 4096, "s": 253, "a": 0, "x": 0, "y": 0, "p": 36,
+			"ram": [[4096, 169], [4097, 128]]},
+		"final": {"pc": 4098, "s": 253, "a": 128, "x": 0, "y": 0, "p": 164,
+			"ram": [[4096, 169], [4097, 128]]},
+		"cycles": [[4096, 169, "read"], [4097, 128, "read"]]
+	},
+	{
+		"name": "e8",
+		"initial": {"pc": 8192, "s": 253, "a": 0, "x": 255, "y": 0, "p": 36,
+			"ram": [[8192, 232]]},
+		"final": {"pc": 8193, "s": 253, "a": 0, "x": 0, "y": 0, "p": 38,
+			"ram": [[8192, 232]]},
+		"cycles": [[8192, 232, "read"], [8193, 0, "read"]]
+	},
+	{
+		"name": "85 10",
+		"initial": {"pc": 12288, "s": 253, "a": 66, "x": 0, "y": 0, "p": 36,
+			"ram": [[12288, 133], [12289, 16], [16, 0]]},
+		"final": {"pc": 12290, "s": 253, "a": 66, "x": 0, "y": 0, "p": 36,
+			"ram": [[12288, 133], [12289, 16], [16, 66]]},
+		"cycles": [[12288, 133, "read"], [12289, 16, "read"], [16, 66, "write"]]
+	},
+	{
+		"name": "20 00 40",
+		"initial": {"pc": 1536, "s": 253, "a": 0, "x": 0, "y": 0, "p": 36,
+			"ram": [[1536, 32], [1537, 0], [1538, 64], [508, 0], [509, 0]]},
+		"final": {"pc": 16384, "s": 251, "a": 0, "x": 0, "y": 0, "p": 36,
+			"ram": [[1536, 32], [1537, 0], [1538, 64], [508, 2], [509, 6]]},
+		"cycles": [[1536, 32, "read"], [1537, 0, "read"], [509, 0, "read"],
+			[509, 6, "write"], [508, 2, "write"], [1538, 64, "read"]]
+	},
+	{
+		"name": "48",
+		"initial": {"pc": 2048, "s": 253, "a": 90, "x": 0, "y": 0, "p": 36,
+			"ram": [[2048, 72], [509, 0]]},
+		"final": {"pc": 2049, "s": 252, "a": 90, "x": 0, "y": 0, "p": 36,
+			"ram": [[2048, 72], [509, 90]]},
+		"cycles": [[2048, 72, "read"], [2049, 0, "read"], [509, 90, "write"]]
+	}
+]`
+
+func TestHarte(t *testing.T) {
+	RunHarteTest(t, []byte(harteSample))
+}
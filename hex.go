@@ -0,0 +1,110 @@
+package emu
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Intel HEX record types.
+const (
+	hexData         = 0x00
+	hexEOF          = 0x01
+	hexSegment      = 0x02
+	hexStartSegment = 0x03
+	hexLinear       = 0x04
+	hexStartLinear  = 0x05
+)
+
+// LoadIntelHex parses an Intel HEX file into a 64k image for NewRWCore.
+// Bytes not covered by a data record are zero.  The entry point is taken
+// from a start address record and is zero if the file doesn't have one.
+// Data outside of the 64k address space is an error.
+func LoadIntelHex(r io.Reader) ([]byte, uint16, error) {
+	image := make([]byte, 0x10000)
+	var entry uint16
+	var base uint32
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		if text[0] != ':' {
+			return nil, 0, fmt.Errorf("hex line %d: missing start code", line)
+		}
+
+		rec, err := hex.DecodeString(text[1:])
+		if err != nil {
+			return nil, 0, fmt.Errorf("hex line %d: %v", line, err)
+		}
+
+		if len(rec) < 5 || len(rec) != int(rec[0])+5 {
+			return nil, 0, fmt.Errorf("hex line %d: bad record length", line)
+		}
+
+		var sum uint8
+		for _, b := range rec {
+			sum += b
+		}
+		if sum != 0 {
+			return nil, 0, fmt.Errorf("hex line %d: checksum mismatch", line)
+		}
+
+		addr := uint32(rec[1])<<8 | uint32(rec[2])
+		data := rec[4 : len(rec)-1]
+
+		switch rec[3] {
+		case hexData:
+			if err := copyImage(image, base+addr, data); err != nil {
+				return nil, 0, fmt.Errorf("hex line %d: %v", line, err)
+			}
+
+		case hexEOF:
+			return image, entry, nil
+
+		case hexSegment:
+			if len(data) != 2 {
+				return nil, 0, fmt.Errorf("hex line %d: bad segment address", line)
+			}
+			base = (uint32(data[0])<<8 | uint32(data[1])) << 4
+
+		case hexLinear:
+			if len(data) != 2 {
+				return nil, 0, fmt.Errorf("hex line %d: bad linear address", line)
+			}
+			base = (uint32(data[0])<<8 | uint32(data[1])) << 16
+
+		case hexStartSegment, hexStartLinear:
+			// Only the low 16 bits mean anything to a 6502.  For a
+			// segment record those are the IP.
+			if len(data) != 4 {
+				return nil, 0, fmt.Errorf("hex line %d: bad start address", line)
+			}
+			entry = uint16(data[2])<<8 | uint16(data[3])
+
+		default:
+			return nil, 0, fmt.Errorf("hex line %d: unknown record type $%02X", line, rec[3])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	return nil, 0, fmt.Errorf("hex: missing EOF record")
+}
+
+// copyImage copies data into a 64k image at addr.
+func copyImage(image []byte, addr uint32, data []byte) error {
+	if addr+uint32(len(data)) > uint32(len(image)) {
+		return fmt.Errorf("data outside of 64k at $%X", addr)
+	}
+	copy(image[addr:], data)
+	return nil
+}
@@ -0,0 +1,71 @@
+package emu
+
+import (
+	"strings"
+	"testing"
+)
+
+const testHex = `:05020000A9428510FF7A
+:02FFFC00000201
+:0400000500000200F5
+:00000001FF
+`
+
+func TestLoadIntelHex(t *testing.T) {
+	image, entry, err := LoadIntelHex(strings.NewReader(testHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(image) != 0x10000 {
+		t.Fatalf("Incorrect image size: Exp:$10000 Got:$%X", len(image))
+	}
+
+	if entry != 0x0200 {
+		t.Errorf("Incorrect entry point: Exp:$0200 Got:$%04X", entry)
+	}
+
+	core, err := NewRWCore(image, 10, StartPC(entry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SetTrap(0xFF, haltTrap)
+
+	if err = core.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.ReadByte(0x0010) != 0x42 {
+		t.Errorf("Incorrect value at $0010: Exp:$42 Got:$%02X", core.ReadByte(0x0010))
+	}
+
+	if core.ReadWord(VECTOR_RESET) != 0x0200 {
+		t.Errorf("Incorrect reset vector: $%04X", core.ReadWord(VECTOR_RESET))
+	}
+}
+
+func TestLoadIntelHexErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+		err  string
+	}{
+		{"checksum", ":05020000A9428510FF7B\n:00000001FF\n", "checksum"},
+		{"no EOF", ":05020000A9428510FF7A\n", "EOF"},
+		{"start code", "05020000A9428510FF7A\n", "start code"},
+		{"length", ":06020000A9428510FF79\n", "length"},
+		{"outside 64k", ":020000040001F9\n:0100000001FE\n:00000001FF\n", "outside"},
+	}
+
+	for _, tc := range tests {
+		_, _, err := LoadIntelHex(strings.NewReader(tc.hex))
+		if err == nil {
+			t.Errorf("%s: Expected an error", tc.name)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: Incorrect error: %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package emu
+
+// Undocumented opcodes.  These are only decoded when allowIllegal is set on
+// the core, otherwise they are treated as unimplemented.
+var illegalInstructionList = [256]Instruction{
+
+	OP_LAX_AB: StandardInstruction{
+		OpCode:         OP_LAX_AB,
+		Instruction:    "LAX",
+		AddressMode: ADDR_Absolute,
+		Exec:           instr_LAX},
+	OP_LAX_AY: StandardInstruction{
+		OpCode:         OP_LAX_AY,
+		Instruction:    "LAX",
+		AddressMode: ADDR_AbsoluteY,
+		Exec:           instr_LAX},
+	OP_LAX_IX: StandardInstruction{
+		OpCode:         OP_LAX_IX,
+		Instruction:    "LAX",
+		AddressMode: ADDR_IndirectX,
+		Exec:           instr_LAX},
+	OP_LAX_IY: StandardInstruction{
+		OpCode:         OP_LAX_IY,
+		Instruction:    "LAX",
+		AddressMode: ADDR_IndirectY,
+		Exec:           instr_LAX},
+	OP_LAX_ZP: StandardInstruction{
+		OpCode:         OP_LAX_ZP,
+		Instruction:    "LAX",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_LAX},
+	OP_LAX_ZY: StandardInstruction{
+		OpCode:         OP_LAX_ZY,
+		Instruction:    "LAX",
+		AddressMode: ADDR_ZeroPageY,
+		Exec:           instr_LAX},
+
+	OP_SAX_AB: StandardInstruction{
+		OpCode:         OP_SAX_AB,
+		Instruction:    "SAX",
+		AddressMode: ADDR_Absolute,
+		Exec:           instr_SAX},
+	OP_SAX_IX: StandardInstruction{
+		OpCode:         OP_SAX_IX,
+		Instruction:    "SAX",
+		AddressMode: ADDR_IndirectX,
+		Exec:           instr_SAX},
+	OP_SAX_ZP: StandardInstruction{
+		OpCode:         OP_SAX_ZP,
+		Instruction:    "SAX",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_SAX},
+	OP_SAX_ZY: StandardInstruction{
+		OpCode:         OP_SAX_ZY,
+		Instruction:    "SAX",
+		AddressMode: ADDR_ZeroPageY,
+		Exec:           instr_SAX},
+
+	OP_ISC_AB: ReadWriteModify{
+		OpCode:         OP_ISC_AB,
+		Instruction:    "ISC",
+		AddressMode: ADDR_Absolute,
+		Exec:           instr_ISC},
+	OP_ISC_AX: ReadWriteModify{
+		OpCode:         OP_ISC_AX,
+		Instruction:    "ISC",
+		AddressMode: ADDR_AbsoluteX,
+		Exec:           instr_ISC},
+	OP_ISC_AY: ReadWriteModify{
+		OpCode:         OP_ISC_AY,
+		Instruction:    "ISC",
+		AddressMode: ADDR_AbsoluteY,
+		Exec:           instr_ISC},
+	OP_ISC_IX: ReadWriteModify{
+		OpCode:         OP_ISC_IX,
+		Instruction:    "ISC",
+		AddressMode: ADDR_IndirectX,
+		Exec:           instr_ISC},
+	OP_ISC_IY: ReadWriteModify{
+		OpCode:         OP_ISC_IY,
+		Instruction:    "ISC",
+		AddressMode: ADDR_IndirectY,
+		Exec:           instr_ISC},
+	OP_ISC_ZP: ReadWriteModify{
+		OpCode:         OP_ISC_ZP,
+		Instruction:    "ISC",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_ISC},
+	OP_ISC_ZX: ReadWriteModify{
+		OpCode:         OP_ISC_ZX,
+		Instruction:    "ISC",
+		AddressMode: ADDR_ZeroPageX,
+		Exec:           instr_ISC},
+
+	OP_NOP_1A: StandardInstruction{
+		OpCode:         OP_NOP_1A,
+		Instruction:    "NOP",
+		AddressMode: ADDR_Implied,
+		Exec:           instr_NOP},
+	OP_NOP_3A: StandardInstruction{
+		OpCode:         OP_NOP_3A,
+		Instruction:    "NOP",
+		AddressMode: ADDR_Implied,
+		Exec:           instr_NOP},
+	OP_NOP_5A: StandardInstruction{
+		OpCode:         OP_NOP_5A,
+		Instruction:    "NOP",
+		AddressMode: ADDR_Implied,
+		Exec:           instr_NOP},
+	OP_NOP_7A: StandardInstruction{
+		OpCode:         OP_NOP_7A,
+		Instruction:    "NOP",
+		AddressMode: ADDR_Implied,
+		Exec:           instr_NOP},
+	OP_NOP_DA: StandardInstruction{
+		OpCode:         OP_NOP_DA,
+		Instruction:    "NOP",
+		AddressMode: ADDR_Implied,
+		Exec:           instr_NOP},
+	OP_NOP_FA: StandardInstruction{
+		OpCode:         OP_NOP_FA,
+		Instruction:    "NOP",
+		AddressMode: ADDR_Implied,
+		Exec:           instr_NOP},
+	OP_NOP_80: StandardInstruction{
+		OpCode:         OP_NOP_80,
+		Instruction:    "NOP",
+		AddressMode: ADDR_Immediate,
+		Exec:           instr_NOP},
+	OP_NOP_82: StandardInstruction{
+		OpCode:         OP_NOP_82,
+		Instruction:    "NOP",
+		AddressMode: ADDR_Immediate,
+		Exec:           instr_NOP},
+	OP_NOP_89: StandardInstruction{
+		OpCode:         OP_NOP_89,
+		Instruction:    "NOP",
+		AddressMode: ADDR_Immediate,
+		Exec:           instr_NOP},
+	OP_NOP_C2: StandardInstruction{
+		OpCode:         OP_NOP_C2,
+		Instruction:    "NOP",
+		AddressMode: ADDR_Immediate,
+		Exec:           instr_NOP},
+	OP_NOP_E2: StandardInstruction{
+		OpCode:         OP_NOP_E2,
+		Instruction:    "NOP",
+		AddressMode: ADDR_Immediate,
+		Exec:           instr_NOP},
+	OP_NOP_04: StandardInstruction{
+		OpCode:         OP_NOP_04,
+		Instruction:    "NOP",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_NOP},
+	OP_NOP_44: StandardInstruction{
+		OpCode:         OP_NOP_44,
+		Instruction:    "NOP",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_NOP},
+	OP_NOP_64: StandardInstruction{
+		OpCode:         OP_NOP_64,
+		Instruction:    "NOP",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_NOP},
+	OP_NOP_14: StandardInstruction{
+		OpCode:         OP_NOP_14,
+		Instruction:    "NOP",
+		AddressMode: ADDR_ZeroPageX,
+		Exec:           instr_NOP},
+	OP_NOP_34: StandardInstruction{
+		OpCode:         OP_NOP_34,
+		Instruction:    "NOP",
+		AddressMode: ADDR_ZeroPageX,
+		Exec:           instr_NOP},
+	OP_NOP_54: StandardInstruction{
+		OpCode:         OP_NOP_54,
+		Instruction:    "NOP",
+		AddressMode: ADDR_ZeroPageX,
+		Exec:           instr_NOP},
+	OP_NOP_74: StandardInstruction{
+		OpCode:         OP_NOP_74,
+		Instruction:    "NOP",
+		AddressMode: ADDR_ZeroPageX,
+		Exec:           instr_NOP},
+	OP_NOP_D4: StandardInstruction{
+		OpCode:         OP_NOP_D4,
+		Instruction:    "NOP",
+		AddressMode: ADDR_ZeroPageX,
+		Exec:           instr_NOP},
+	OP_NOP_F4: StandardInstruction{
+		OpCode:         OP_NOP_F4,
+		Instruction:    "NOP",
+		AddressMode: ADDR_ZeroPageX,
+		Exec:           instr_NOP},
+	OP_NOP_0C: StandardInstruction{
+		OpCode:         OP_NOP_0C,
+		Instruction:    "NOP",
+		AddressMode: ADDR_Absolute,
+		Exec:           instr_NOP},
+	OP_NOP_1C: StandardInstruction{
+		OpCode:         OP_NOP_1C,
+		Instruction:    "NOP",
+		AddressMode: ADDR_AbsoluteX,
+		Exec:           instr_NOP},
+	OP_NOP_3C: StandardInstruction{
+		OpCode:         OP_NOP_3C,
+		Instruction:    "NOP",
+		AddressMode: ADDR_AbsoluteX,
+		Exec:           instr_NOP},
+	OP_NOP_5C: StandardInstruction{
+		OpCode:         OP_NOP_5C,
+		Instruction:    "NOP",
+		AddressMode: ADDR_AbsoluteX,
+		Exec:           instr_NOP},
+	OP_NOP_7C: StandardInstruction{
+		OpCode:         OP_NOP_7C,
+		Instruction:    "NOP",
+		AddressMode: ADDR_AbsoluteX,
+		Exec:           instr_NOP},
+	OP_NOP_DC: StandardInstruction{
+		OpCode:         OP_NOP_DC,
+		Instruction:    "NOP",
+		AddressMode: ADDR_AbsoluteX,
+		Exec:           instr_NOP},
+	OP_NOP_FC: StandardInstruction{
+		OpCode:         OP_NOP_FC,
+		Instruction:    "NOP",
+		AddressMode: ADDR_AbsoluteX,
+		Exec:           instr_NOP},
+}
+
+// Load A and X with the same value.
+func instr_LAX(c *Core, address uint16) {
+	c.A = c.ReadByte(address)
+	c.X = c.A
+	c.setZeroNegative(c.A)
+}
+
+// Store A AND X.  No flags are affected.
+func instr_SAX(c *Core, address uint16) {
+	c.WriteByte(address, c.A&c.X)
+}
+
+// Increment memory, then subtract it from A like SBC.
+func instr_ISC(c *Core, value uint8) uint8 {
+	value += 1
+	c.A = c.twosCompSubtract(c.A, value)
+	return value
+}
@@ -0,0 +1,238 @@
+package emu
+
+import (
+	"strings"
+	"testing"
+)
+
+var illegalBasic = []basicTest{
+	// LAX
+	basicTest{
+		"OP_LAX_ZP",
+		[]byte{OP_LAX_ZP, 0x05},
+		regState{},
+		regState{0x05, 0x05, 0x00, 0x8002, 0x00, 0x00}},
+	basicTest{
+		"OP_LAX_ZY",
+		[]byte{OP_LAX_ZY, 0x03},
+		regState{y: 0x02},
+		regState{0x05, 0x05, 0x02, 0x8002, 0x00, 0x00}},
+	basicTest{
+		"OP_LAX_AB",
+		[]byte{OP_LAX_AB, 0x00, 0x80},
+		regState{},
+		regState{OP_LAX_AB, OP_LAX_AB, 0x00, 0x8003, FLAG_NEGATIVE, 0x00}},
+	basicTest{
+		"OP_LAX_AY",
+		[]byte{OP_LAX_AY, 0xFD, 0x7F}, // address is three before OpCode
+		regState{y: 0x03},
+		regState{OP_LAX_AY, OP_LAX_AY, 0x03, 0x8003, FLAG_NEGATIVE, 0x00}},
+	basicTest{
+		"OP_LAX_IX",
+		// pointer is at $7C + 2 (x) = $7E, pointing to $7F7E (no WRAM)
+		[]byte{OP_LAX_IX, 0x7C},
+		regState{x: 0x02},
+		regState{0x00, 0x00, 0x00, 0x8002, FLAG_ZERO, 0x00}},
+	basicTest{
+		"OP_LAX_IY",
+		[]byte{OP_LAX_IY, 0x7E}, // pointer should be $7F7E
+		regState{y: 130},
+		regState{OP_LAX_IY, OP_LAX_IY, 130, 0x8002, FLAG_NEGATIVE, 0x00}},
+
+	// NOP
+	basicTest{
+		"OP_NOP_1A",
+		[]byte{OP_NOP_1A},
+		regState{},
+		regState{0x00, 0x00, 0x00, 0x8001, 0x00, 0x00}},
+	basicTest{
+		"OP_NOP_80",
+		[]byte{OP_NOP_80, 0x12},
+		regState{},
+		regState{0x00, 0x00, 0x00, 0x8002, 0x00, 0x00}},
+	basicTest{
+		"OP_NOP_04",
+		[]byte{OP_NOP_04, 0x12},
+		regState{},
+		regState{0x00, 0x00, 0x00, 0x8002, 0x00, 0x00}},
+	basicTest{
+		"OP_NOP_14",
+		[]byte{OP_NOP_14, 0x12},
+		regState{x: 0x01},
+		regState{0x00, 0x01, 0x00, 0x8002, 0x00, 0x00}},
+	basicTest{
+		"OP_NOP_0C",
+		[]byte{OP_NOP_0C, 0x34, 0x12},
+		regState{},
+		regState{0x00, 0x00, 0x00, 0x8003, 0x00, 0x00}},
+	basicTest{
+		"OP_NOP_1C",
+		[]byte{OP_NOP_1C, 0x34, 0x12},
+		regState{x: 0x01},
+		regState{0x00, 0x01, 0x00, 0x8003, 0x00, 0x00}},
+}
+
+var illegalMemory = []memTest{
+	// SAX
+	memTest{
+		"OP_SAX_AB",
+		[]byte{OP_SAX_AB, 0x00, 0x03},
+		memVal{0x0300, 0x0A},
+		regState{a: 0x0F, x: 0xFA, phlags: FLAG_ZERO | FLAG_NEGATIVE},
+		regState{0x0F, 0xFA, 0x00, 0x8003, FLAG_ZERO | FLAG_NEGATIVE, 0x00}},
+	memTest{
+		"OP_SAX_ZP",
+		[]byte{OP_SAX_ZP, 0x03},
+		memVal{0x0003, 0x80},
+		regState{a: 0xC0, x: 0x81, phlags: FLAG_CARRY},
+		regState{0xC0, 0x81, 0x00, 0x8002, FLAG_CARRY, 0x00}},
+	memTest{
+		"OP_SAX_ZY",
+		[]byte{OP_SAX_ZY, 0x03},
+		memVal{0x0005, 0x00},
+		regState{a: 0xF0, x: 0x0F, y: 0x02},
+		regState{0xF0, 0x0F, 0x02, 0x8002, 0x00, 0x00}},
+	memTest{
+		"OP_SAX_IX",
+		// pointer is at $0001 + 1 (x) = $0002
+		// should be a pointer val of $0302
+		[]byte{OP_SAX_IX, 0x01},
+		memVal{0x0302, 0x01},
+		regState{a: 0xFF, x: 0x01, phlags: FLAG_OVERFLOW},
+		regState{0xFF, 0x01, 0x00, 0x8002, FLAG_OVERFLOW, 0x00}},
+
+	// ISC
+	memTest{
+		"OP_ISC_ZP",
+		[]byte{OP_ISC_ZP, 0x03},
+		memVal{0x0003, 0x04},
+		regState{a: 0x10, phlags: FLAG_CARRY},
+		regState{0x0C, 0x00, 0x00, 0x8002, FLAG_CARRY, 0x00}},
+	memTest{
+		"OP_ISC_ZX",
+		[]byte{OP_ISC_ZX, 0x7F},
+		memVal{0x0080, 0x81},
+		regState{a: 0x01, x: 0x01, phlags: FLAG_CARRY},
+		regState{0x80, 0x01, 0x00, 0x8002, FLAG_NEGATIVE | FLAG_OVERFLOW, 0x00}},
+}
+
+func TestIllegalBasic(t *testing.T) {
+	core := newTestCore(t)
+	core.allowIllegal = true
+
+	for _, bt := range illegalBasic {
+		t.Run(bt.name, func(t *testing.T) {
+			testsRun++
+
+			err := core.resetTest(t, bt.rom, nil)
+			if err != nil {
+				t.Errorf("%s: %v", bt.name, err)
+			}
+
+			core.setRegisters(t, bt.regInitial)
+
+			ticksran := 0
+			for !core.halted {
+				err = core.tick()
+				if err != nil {
+					t.Fatalf("%s: %v", bt.name, err)
+				}
+				ticksran++
+				if ticksran > 1000 {
+					t.Error("Tick limit hit")
+					break
+				}
+			}
+
+			core.checkRegisters(t, bt.name, bt.regExpected)
+			if t.Failed() {
+				core.dumpPage(0, t)
+				core.dumpReg(t)
+			}
+		})
+	}
+}
+
+func TestIllegalMemory(t *testing.T) {
+	core := newTestCore(t)
+	core.allowIllegal = true
+
+	for _, mt := range illegalMemory {
+		t.Run(mt.name, func(t *testing.T) {
+			testsRun++
+
+			err := core.resetTest(t, mt.rom, nil)
+			if err != nil {
+				t.Errorf("%s: %v", mt.name, err)
+			}
+
+			core.setRegisters(t, mt.regInitial)
+
+			for !core.halted {
+				err = core.tick()
+				if err != nil {
+					t.Fatalf("%s: %v", mt.name, err)
+				}
+			}
+
+			core.checkRegisters(t, mt.name, mt.regExpected)
+
+			if core.ReadByte(mt.mem.addr) != mt.mem.val {
+				t.Errorf("%s: Incorrect memory value at $%04X: Exp:$%02X Got:$%02X", mt.name, mt.mem.addr, mt.mem.val, core.ReadByte(mt.mem.addr))
+			}
+
+			if t.Failed() {
+				core.dumpPage(0x00, t)
+				core.dumpPage(0x03, t)
+				core.dumpReg(t)
+			}
+		})
+	}
+}
+
+func TestIllegalDisabled(t *testing.T) {
+	core := newTestCore(t)
+	for _, bt := range illegalBasic {
+		t.Run(bt.name, func(t *testing.T) {
+			err := core.resetTest(t, bt.rom, nil)
+			if err != nil {
+				t.Fatalf("%s: %v", bt.name, err)
+			}
+
+			err = core.tick()
+			if err == nil || !strings.Contains(err.Error(), "not implemented") {
+				t.Errorf("%s: Expected unimplemented error, got: %v", bt.name, err)
+			}
+		})
+	}
+}
+
+func TestHaltOpcode(t *testing.T) {
+	core := newTestCore(t)
+	core.allowIllegal = true
+	core.HaltOpcode = 0x02 // KIL, which is no use to a test anyway
+
+	err := core.resetTest(t, []byte{
+		OP_LDX_IM, 0x01,
+		OP_ISC_AX, 0xFF, 0x02, // $02FF + X
+		0x02,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	core.A = 0x10
+	core.Phlags = FLAG_CARRY
+	core.memory[0x0300] = 0x04
+
+	for !core.halted {
+		if err = core.tick(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	core.checkRegisters(t, "OP_ISC_AX", regState{0x0B, 0x01, 0x00, 0x8005, FLAG_CARRY, 0x00})
+	if core.memory[0x0300] != 0x05 {
+		t.Errorf("Incorrect memory value at $0300: Exp:$05 Got:$%02X", core.memory[0x0300])
+	}
+}
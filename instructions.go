@@ -11,9 +11,15 @@ type Instruction interface {
 	Name() string
 	InstrLength(c *Core) uint8
 	AddressMeta() AddressModeMeta
+
+	// Cycles returns the number of cycles the instruction at the current
+	// PC will take, including page crossing and taken branch penalties.
+	// It must not have side effects.
+	Cycles(c *Core) uint8
 }
 
-var instructionList = map[byte]Instruction{
+// Documented instructions indexed by opcode.  Unused opcodes are nil.
+var instructionList = [256]Instruction{
 
 	OP_ADC_AB: StandardInstruction{
 		OpCode:         OP_ADC_AB,
@@ -56,6 +62,31 @@ var instructionList = map[byte]Instruction{
 		AddressMode: ADDR_ZeroPageX,
 		Exec:           instr_ADC},
 
+	OP_ASL_AC: Accumulator{
+		OpCode:         OP_ASL_AC,
+		Instruction:    "ASL",
+		Exec:           instr_ASL},
+	OP_ASL_AB: ReadWriteModify{
+		OpCode:         OP_ASL_AB,
+		Instruction:    "ASL",
+		AddressMode: ADDR_Absolute,
+		Exec:           instr_ASL},
+	OP_ASL_AX: ReadWriteModify{
+		OpCode:         OP_ASL_AX,
+		Instruction:    "ASL",
+		AddressMode: ADDR_AbsoluteX,
+		Exec:           instr_ASL},
+	OP_ASL_ZP: ReadWriteModify{
+		OpCode:         OP_ASL_ZP,
+		Instruction:    "ASL",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_ASL},
+	OP_ASL_ZX: ReadWriteModify{
+		OpCode:         OP_ASL_ZX,
+		Instruction:    "ASL",
+		AddressMode: ADDR_ZeroPageX,
+		Exec:           instr_ASL},
+
 	OP_BCC: Branch{
 		OpCode: OP_BCC,
 		Instruction: "BCC",
@@ -97,6 +128,17 @@ var instructionList = map[byte]Instruction{
 		Flag: FLAG_OVERFLOW,
 		Set: true},
 
+	OP_BIT_AB: StandardInstruction{
+		OpCode:         OP_BIT_AB,
+		Instruction:    "BIT",
+		AddressMode: ADDR_Absolute,
+		Exec:           instr_BIT},
+	OP_BIT_ZP: StandardInstruction{
+		OpCode:         OP_BIT_ZP,
+		Instruction:    "BIT",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_BIT},
+
 	OP_BRK: Jump{
 		OpCode:         OP_BRK,
 		Instruction:    "BRK",
@@ -422,6 +464,31 @@ var instructionList = map[byte]Instruction{
 		AddressMode: ADDR_Implied,
 		Exec:           instr_INY},
 
+	OP_LSR_AC: Accumulator{
+		OpCode:         OP_LSR_AC,
+		Instruction:    "LSR",
+		Exec:           instr_LSR},
+	OP_LSR_AB: ReadWriteModify{
+		OpCode:         OP_LSR_AB,
+		Instruction:    "LSR",
+		AddressMode: ADDR_Absolute,
+		Exec:           instr_LSR},
+	OP_LSR_AX: ReadWriteModify{
+		OpCode:         OP_LSR_AX,
+		Instruction:    "LSR",
+		AddressMode: ADDR_AbsoluteX,
+		Exec:           instr_LSR},
+	OP_LSR_ZP: ReadWriteModify{
+		OpCode:         OP_LSR_ZP,
+		Instruction:    "LSR",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_LSR},
+	OP_LSR_ZX: ReadWriteModify{
+		OpCode:         OP_LSR_ZX,
+		Instruction:    "LSR",
+		AddressMode: ADDR_ZeroPageX,
+		Exec:           instr_LSR},
+
 	OP_NOP: StandardInstruction{
 		OpCode:         OP_NOP,
 		Instruction:    "NOP",
@@ -490,6 +557,97 @@ var instructionList = map[byte]Instruction{
 		AddressMode: ADDR_Implied,
 		Exec:           instr_PLP},
 
+	OP_ROL_AC: Accumulator{
+		OpCode:         OP_ROL_AC,
+		Instruction:    "ROL",
+		Exec:           instr_ROL},
+	OP_ROL_AB: ReadWriteModify{
+		OpCode:         OP_ROL_AB,
+		Instruction:    "ROL",
+		AddressMode: ADDR_Absolute,
+		Exec:           instr_ROL},
+	OP_ROL_AX: ReadWriteModify{
+		OpCode:         OP_ROL_AX,
+		Instruction:    "ROL",
+		AddressMode: ADDR_AbsoluteX,
+		Exec:           instr_ROL},
+	OP_ROL_ZP: ReadWriteModify{
+		OpCode:         OP_ROL_ZP,
+		Instruction:    "ROL",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_ROL},
+	OP_ROL_ZX: ReadWriteModify{
+		OpCode:         OP_ROL_ZX,
+		Instruction:    "ROL",
+		AddressMode: ADDR_ZeroPageX,
+		Exec:           instr_ROL},
+
+	OP_ROR_AC: Accumulator{
+		OpCode:         OP_ROR_AC,
+		Instruction:    "ROR",
+		Exec:           instr_ROR},
+	OP_ROR_AB: ReadWriteModify{
+		OpCode:         OP_ROR_AB,
+		Instruction:    "ROR",
+		AddressMode: ADDR_Absolute,
+		Exec:           instr_ROR},
+	OP_ROR_AX: ReadWriteModify{
+		OpCode:         OP_ROR_AX,
+		Instruction:    "ROR",
+		AddressMode: ADDR_AbsoluteX,
+		Exec:           instr_ROR},
+	OP_ROR_ZP: ReadWriteModify{
+		OpCode:         OP_ROR_ZP,
+		Instruction:    "ROR",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_ROR},
+	OP_ROR_ZX: ReadWriteModify{
+		OpCode:         OP_ROR_ZX,
+		Instruction:    "ROR",
+		AddressMode: ADDR_ZeroPageX,
+		Exec:           instr_ROR},
+
+	OP_SBC_AB: StandardInstruction{
+		OpCode:         OP_SBC_AB,
+		Instruction:    "SBC",
+		AddressMode: ADDR_Absolute,
+		Exec:           instr_SBC},
+	OP_SBC_AX: StandardInstruction{
+		OpCode:         OP_SBC_AX,
+		Instruction:    "SBC",
+		AddressMode: ADDR_AbsoluteX,
+		Exec:           instr_SBC},
+	OP_SBC_AY: StandardInstruction{
+		OpCode:         OP_SBC_AY,
+		Instruction:    "SBC",
+		AddressMode: ADDR_AbsoluteY,
+		Exec:           instr_SBC},
+	OP_SBC_IM: StandardInstruction{
+		OpCode:         OP_SBC_IM,
+		Instruction:    "SBC",
+		AddressMode: ADDR_Immediate,
+		Exec:           instr_SBC},
+	OP_SBC_IX: StandardInstruction{
+		OpCode:         OP_SBC_IX,
+		Instruction:    "SBC",
+		AddressMode: ADDR_IndirectX,
+		Exec:           instr_SBC},
+	OP_SBC_IY: StandardInstruction{
+		OpCode:         OP_SBC_IY,
+		Instruction:    "SBC",
+		AddressMode: ADDR_IndirectY,
+		Exec:           instr_SBC},
+	OP_SBC_ZP: StandardInstruction{
+		OpCode:         OP_SBC_ZP,
+		Instruction:    "SBC",
+		AddressMode: ADDR_ZeroPage,
+		Exec:           instr_SBC},
+	OP_SBC_ZX: StandardInstruction{
+		OpCode:         OP_SBC_ZX,
+		Instruction:    "SBC",
+		AddressMode: ADDR_ZeroPageX,
+		Exec:           instr_SBC},
+
 	OP_SEC: StandardInstruction{
 		OpCode:         OP_SEC,
 		Instruction:    "SEC",
@@ -624,14 +782,29 @@ func (i StandardInstruction) Execute(c *Core) {
 }
 
 func (i StandardInstruction) InstrLength(c *Core) uint8 {
-	_, size := i.AddressMode.Address(c)
-	return size
+	return i.AddressMode.Size()
 }
 
 func (i StandardInstruction) Name() string {
 	return i.Instruction
 }
 
+func (i StandardInstruction) Cycles(c *Core) uint8 {
+	base := c.baseCycles(c.PeekByte(c.PC))
+	return base + c.pageCrossPenalty(i.AddressMode, base)
+}
+
+// Zero is set from A AND the operand, Negative and Overflow are copied from
+// bits 7 and 6 of the operand.
+func instr_BIT(c *Core, address uint16) {
+	value := c.ReadByte(address)
+	c.Phlags &^= FLAG_ZERO | FLAG_NEGATIVE | FLAG_OVERFLOW
+	if c.A&value == 0 {
+		c.Phlags |= FLAG_ZERO
+	}
+	c.Phlags |= value & (FLAG_NEGATIVE | FLAG_OVERFLOW)
+}
+
 func instr_CLC(c *Core, address uint16) {
 	c.Phlags &^= FLAG_CARRY
 }
@@ -648,9 +821,13 @@ func instr_CLV(c *Core, address uint16) {
 	c.Phlags &^= FLAG_OVERFLOW
 }
 
+// compare sets the flags for a - b.  N and Z come from the difference, not
+// from b, and C is set if there was no borrow.  V is unaffected.
 func (c *Core) compare(a, b uint8) {
 	overflow := c.Phlags & FLAG_OVERFLOW
-	c.Phlags &^= FLAG_CARRY
+
+	// Compare is a subtract without borrow.
+	c.Phlags |= FLAG_CARRY
 
 	val := c.twosCompSubtract(a, b)
 	c.Phlags = (c.Phlags &^ FLAG_OVERFLOW) | overflow
@@ -660,6 +837,11 @@ func (c *Core) compare(a, b uint8) {
 	}
 }
 
+func instr_AND(c *Core, address uint16) {
+	c.A &= c.ReadByte(address)
+	c.setZeroNegative(c.A)
+}
+
 func instr_CMP(c *Core, address uint16) {
 	c.compare(c.A, c.ReadByte(address))
 }
@@ -673,7 +855,9 @@ func instr_CPY(c *Core, address uint16) {
 }
 
 func instr_ADC(c *Core, address uint16) {
-	c.A = c.twosCompAdd(c.A, c.ReadByte(address))
+	value := c.ReadByte(address)
+	c.checkBCD(value)
+	c.A = c.twosCompAdd(c.A, value)
 }
 
 func instr_DEX(c *Core, address uint16) {
@@ -738,11 +922,13 @@ func instr_PLA(c *Core, address uint16) {
 }
 
 func instr_PLP(c *Core, address uint16) {
-	c.Phlags = c.pullByte() & (0xCF) // ignore bits 4 and 5
+	c.Phlags = c.pullByte()&^0x10 | FLAG_IRQ // drop B, force bit 5
 }
 
 func instr_SBC(c *Core, address uint16) {
-	c.A = c.twosCompSubtract(c.A, c.ReadByte(address))
+	value := c.ReadByte(address)
+	c.checkBCD(value)
+	c.A = c.twosCompSubtract(c.A, value)
 }
 
 func instr_SEC(c *Core, address uint16) {
@@ -811,7 +997,15 @@ func (rwm ReadWriteModify) AddressMeta() AddressModeMeta {
 
 func (rwm ReadWriteModify) Execute(c *Core) {
 	address, size := rwm.AddressMode.Address(c)
-	c.WriteByte(address, rwm.Exec(c, c.ReadByte(address)))
+	value := c.ReadByte(address)
+
+	// The NMOS 6502 writes the unmodified value back before writing the
+	// result.  The value comes from ReadByte, so a register's read handler
+	// supplies it even if the register is write-only on the real hardware.
+	if c.dummyWrites && c.variant == VariantNMOS {
+		c.WriteByte(address, value)
+	}
+	c.WriteByte(address, rwm.Exec(c, value))
 	c.PC += uint16(size)
 }
 
@@ -820,8 +1014,12 @@ func (rwm ReadWriteModify) Name() string {
 }
 
 func (rwm ReadWriteModify) InstrLength(c *Core) uint8 {
-	_, size := rwm.AddressMode.Address(c)
-	return size
+	return rwm.AddressMode.Size()
+}
+
+// The extra cycle for indexing is always taken, so there is no penalty.
+func (rwm ReadWriteModify) Cycles(c *Core) uint8 {
+	return c.baseCycles(c.PeekByte(c.PC))
 }
 
 func instr_DEC(c *Core, value uint8) uint8 {
@@ -836,6 +1034,66 @@ func instr_INC(c *Core, value uint8) uint8 {
 	return value
 }
 
+// Shift and rotate carry in/out of the Carry flag.
+func instr_ASL(c *Core, value uint8) uint8 {
+	c.setCarry(value&0x80 != 0)
+	value <<= 1
+	c.setZeroNegative(value)
+	return value
+}
+
+func instr_LSR(c *Core, value uint8) uint8 {
+	c.setCarry(value&0x01 != 0)
+	value >>= 1
+	c.setZeroNegative(value)
+	return value
+}
+
+func instr_ROL(c *Core, value uint8) uint8 {
+	carry := c.Phlags & FLAG_CARRY
+	c.setCarry(value&0x80 != 0)
+	value = value<<1 | carry
+	c.setZeroNegative(value)
+	return value
+}
+
+func instr_ROR(c *Core, value uint8) uint8 {
+	carry := c.Phlags & FLAG_CARRY
+	c.setCarry(value&0x01 != 0)
+	value = value>>1 | carry<<7
+	c.setZeroNegative(value)
+	return value
+}
+
+// Read-modify-write instructions that operate on the accumulator instead
+// of memory.
+type Accumulator struct {
+	OpCode      byte
+	Instruction string
+	Exec        func(c *Core, value uint8) uint8
+}
+
+func (a Accumulator) AddressMeta() AddressModeMeta {
+	return ADDR_Accumulator
+}
+
+func (a Accumulator) Execute(c *Core) {
+	c.A = a.Exec(c, c.A)
+	c.PC += 1
+}
+
+func (a Accumulator) Name() string {
+	return a.Instruction
+}
+
+func (a Accumulator) InstrLength(c *Core) uint8 {
+	return 1
+}
+
+func (a Accumulator) Cycles(c *Core) uint8 {
+	return c.baseCycles(c.PeekByte(c.PC))
+}
+
 type Branch struct {
 	OpCode byte
 	Instruction string
@@ -851,13 +1109,16 @@ func (b Branch) Name() string {
 	return b.Instruction
 }
 
-func (b Branch) Execute(c *Core) {
+func (b Branch) taken(c *Core) bool {
 	var v uint8 = 0
 	if b.Set {
 		v = b.Flag
 	}
+	return (c.Phlags & b.Flag) == v
+}
 
-	if (c.Phlags & b.Flag) == v {
+func (b Branch) Execute(c *Core) {
+	if b.taken(c) {
 		c.PC = c.addrRelative(c.PC, c.ReadByte(c.PC + 1))
 	} else {
 		c.PC += 2
@@ -868,12 +1129,24 @@ func (b Branch) InstrLength(c *Core) uint8 {
 	return 2
 }
 
+// A taken branch costs one more cycle, and another if the target is on a
+// different page than the next instruction.
+func (b Branch) Cycles(c *Core) uint8 {
+	cycles := c.baseCycles(c.PeekByte(c.PC))
+	if b.taken(c) {
+		cycles += branchPenalty(c.PC+2, c.addrRelative(c.PC, c.PeekByte(c.PC+1)))
+	}
+	return cycles
+}
+
 // anything that modifies the PC directly, aside form branches
 type Jump struct {
 	OpCode byte
 	Instruction string
 	AddressMode AddressModeMeta
-	Exec func(c *Core, address uint16) uint16
+	// Exec is given the resolved address and the address of the
+	// instruction following this one, and returns the new PC.
+	Exec func(c *Core, address, next uint16) uint16
 }
 
 func (j Jump) Name() string {
@@ -881,40 +1154,58 @@ func (j Jump) Name() string {
 }
 
 func (j Jump) Execute(c *Core) {
-	address, _ := j.AddressMode.Address(c)
-	c.PC = j.Exec(c, address)
+	address, size := j.AddressMode.Address(c)
+	c.PC = j.Exec(c, address, c.PC+uint16(size))
 }
 
 func (j Jump) InstrLength(c *Core) uint8 {
-	_, size := j.AddressMode.Address(c)
-	return size
+	return j.AddressMode.Size()
+}
+
+func (j Jump) Cycles(c *Core) uint8 {
+	return c.baseCycles(c.PeekByte(c.PC))
 }
 
 func (j Jump) AddressMeta() AddressModeMeta {
 	return j.AddressMode
 }
 
-func instr_JMP(c *Core, address uint16) uint16 {
+func instr_JMP(c *Core, address, next uint16) uint16 {
 	return address
 }
 
-func instr_JSR(c *Core, address uint16) uint16 {
-	c.pushAddress(c.PC + 2)
+// JSR pushes the address of its last operand byte, not the address of the
+// next instruction.  RTS adds one to the pulled address to compensate.
+func instr_JSR(c *Core, address, next uint16) uint16 {
+	c.pushAddress(next - 1)
+	c.callDepth++
 	return address
 }
 
-func instr_RTS(c *Core, address uint16) uint16 {
+func instr_RTS(c *Core, address, next uint16) uint16 {
+	c.returned()
 	return c.pullAddress() + 1
 }
 
-func instr_RTI(c *Core, address uint16) uint16 {
-	c.Phlags = c.pullByte()
+func instr_RTI(c *Core, address, next uint16) uint16 {
+	c.returned()
+	c.Phlags = c.pullByte()&^0x10 | FLAG_IRQ // drop B, force bit 5
 	return c.pullAddress()
 }
 
-func instr_BRK(c *Core, address uint16) uint16 {
-	c.pushAddress(c.PC + 2)
+// Decrement the call depth without going negative.  An unbalanced return
+// can happen when a program manipulates the stack directly.
+func (c *Core) returned() {
+	if c.callDepth > 0 {
+		c.callDepth--
+	}
+}
+
+func instr_BRK(c *Core, address, next uint16) uint16 {
+	c.callDepth++
+	// BRK is followed by a padding byte that is skipped on return.
+	c.pushAddress(next + 1)
 	c.pushByte(c.Phlags | FLAG_BREAK)
 	c.Phlags = c.Phlags | FLAG_INTERRUPT
-	return c.ReadWord(0xFFFE)
+	return c.ReadWord(c.breakVector())
 }
@@ -0,0 +1,92 @@
+package emu
+
+// IRQ services a maskable interrupt request before the next instruction.
+// The request is ignored, and false returned, while the interrupt disable
+// flag is set or the CPU is stopped by STP.  A CPU waiting after WAI wakes
+// up either way, and continues after the WAI if the interrupt is masked.
+func (c *Core) IRQ() bool {
+	if c.stopped {
+		return false
+	}
+
+	if c.Phlags&FLAG_INTERRUPT != 0 {
+		c.waiting = false
+		return false
+	}
+
+	c.interrupt(VECTOR_IRQ)
+	return true
+}
+
+// NMI services a non-maskable interrupt before the next instruction.  It is
+// ignored while the CPU is stopped by STP.
+func (c *Core) NMI() {
+	if c.stopped {
+		return
+	}
+	c.interrupt(VECTOR_NMI)
+}
+
+// RaiseNMI signals a non-maskable interrupt that is serviced before the next
+// instruction.  On the NMOS 6502 an NMI raised while a BRK is pushing its
+// return address and status hijacks the BRK: the status still has the B
+// flag set, but the NMI vector is used and the NMI isn't serviced again.
+func (c *Core) RaiseNMI() {
+	c.nmiPending = true
+}
+
+// breakVector returns the vector BRK jumps through, handling an NMI that
+// hijacks it.
+func (c *Core) breakVector() uint16 {
+	if c.nmiPending && c.variant == VariantNMOS {
+		c.nmiPending = false
+		return VECTOR_NMI
+	}
+	return VECTOR_IRQ
+}
+
+// interrupt pushes the PC and status and jumps through vector.  Unlike BRK
+// and PHP, the pushed status has the B flag clear so a handler can tell a
+// hardware interrupt from a BRK.
+func (c *Core) interrupt(vector uint16) {
+	pc := c.PC
+	flags := c.Phlags
+
+	c.waiting = false
+	c.callDepth++
+	c.pushAddress(c.PC)
+	c.pushByte(c.Phlags&^FLAG_BREAK | FLAG_IRQ)
+	c.Phlags |= FLAG_INTERRUPT
+	c.PC = c.ReadWord(vector)
+	c.addCycles(7)
+
+	if c.Phlags != flags {
+		c.flagChanges(pc, flags)
+	}
+}
+
+// Reset performs a hardware reset.  The PC is loaded from the reset vector,
+// even if the core was created with StartPC, the stack pointer drops by
+// three as if the return address and status were pushed, and interrupts are
+// disabled.  The 65C02 variants also clear the decimal flag.  A, X, Y, and
+// memory are left alone.  This is the only way to resume after STP, and it
+// also ends a WAI and a pending NMI.
+func (c *Core) Reset() {
+	c.stopped = false
+	c.waiting = false
+	c.jammed = false
+	c.nmiPending = false
+	c.callDepth = 0
+
+	c.SP -= 3
+	c.Phlags |= FLAG_INTERRUPT
+	if c.variant != VariantNMOS {
+		c.Phlags &^= FLAG_DECIMAL
+	}
+	c.PC = c.ReadWord(VECTOR_RESET)
+	c.addCycles(7)
+
+	// Don't let the reset PC count towards the stuck detector.
+	c.lastPC = c.PC
+	c.lastSame = 0
+}
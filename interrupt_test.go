@@ -0,0 +1,255 @@
+package emu
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// interruptROM saves the status pushed on entry to its handler at $20+Y.
+func interruptROM() []byte {
+	rom := PadWithVectors([]byte{
+		OP_CLI,          // $8000
+		OP_LDY_IM, 0x00, // $8001
+		OP_NOP,          // $8003, interrupted before this
+		OP_LDY_IM, 0x01, // $8004
+		OP_BRK, 0x00, // $8006
+		0xFF, // $8008
+	}, 0x8010, 0x8000, 0x8010)
+
+	copy(rom[0x10:], []byte{
+		OP_PLA, // $8010
+		OP_PHA,
+		OP_STA_AY, 0x20, 0x00,
+		OP_RTI,
+	})
+	return rom
+}
+
+func TestInterruptBreakFlag(t *testing.T) {
+	core, err := NewCore(interruptROM(), false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SetTrap(0xFF, haltTrap)
+	core.SP = 0xFD
+
+	for i := 0; i < 2; i++ {
+		if err = core.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !core.IRQ() {
+		t.Fatal("IRQ was not taken")
+	}
+
+	if err = core.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	irq, brk := core.memory[0x20], core.memory[0x21]
+	if irq&FLAG_BREAK != FLAG_IRQ {
+		t.Errorf("Incorrect status pushed by IRQ: %08b", irq)
+	}
+
+	if brk&FLAG_BREAK != FLAG_BREAK {
+		t.Errorf("Incorrect status pushed by BRK: %08b", brk)
+	}
+
+	// Both returned to the right place with the stack balanced.
+	if core.PC != 0x8008 || core.SP != 0xFD || core.Y != 0x01 {
+		t.Errorf("Incorrect state after return: PC:$%04X SP:$%02X Y:%d", core.PC, core.SP, core.Y)
+	}
+}
+
+func TestInterruptMasking(t *testing.T) {
+	core, err := NewCore(interruptROM(), false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SP = 0xFD
+	core.Phlags = FLAG_INTERRUPT
+
+	if core.IRQ() {
+		t.Errorf("IRQ was taken with interrupts disabled")
+	}
+
+	if core.PC != 0x8000 || core.SP != 0xFD {
+		t.Errorf("Masked IRQ changed state: PC:$%04X SP:$%02X", core.PC, core.SP)
+	}
+
+	core.NMI()
+	if core.PC != 0x8010 {
+		t.Errorf("NMI was not taken: PC:$%04X", core.PC)
+	}
+
+	status := core.memory[0x01FB]
+	if status&FLAG_BREAK != FLAG_IRQ || status&FLAG_INTERRUPT == 0 {
+		t.Errorf("Incorrect status pushed by NMI: %08b", status)
+	}
+}
+
+func TestNMIHijacksBRK(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_BRK, 0x00, // $8000
+		0xFF,            // $8002
+		OP_LDA_IM, 0x01, // $8003, IRQ handler
+		OP_RTI,
+		OP_LDA_IM, 0x02, // $8006, NMI handler
+		OP_RTI,
+	}, 0x8006, 0x8000, 0x8003)
+
+	for _, variant := range []Variant{VariantNMOS, Variant65C02} {
+		core, err := NewCore(rom, false, 0, CPUVariant(variant))
+		if err != nil {
+			t.Fatal(err)
+		}
+		core.SetTrap(0xFF, haltTrap)
+		core.SP = 0xFD
+
+		// Raise the NMI while BRK pushes the status.
+		core.MapWrite(0x01FB, 0x01FB, func(addr uint16, value uint8) {
+			core.memory[addr] = value
+			core.RaiseNMI()
+		})
+
+		if err = core.Step(); err != nil {
+			t.Fatal(err)
+		}
+
+		if variant == VariantNMOS {
+			if core.PC != 0x8006 {
+				t.Errorf("NMOS: BRK was not hijacked: PC:$%04X", core.PC)
+			}
+
+			// The B flag is still set since this started as a BRK.
+			if core.memory[0x01FB]&FLAG_BREAK != FLAG_BREAK {
+				t.Errorf("NMOS: Incorrect status pushed: %08b", core.memory[0x01FB])
+			}
+		} else if core.PC != 0x8003 {
+			t.Errorf("65C02: BRK was hijacked: PC:$%04X", core.PC)
+		}
+
+		if err = core.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		// The hijacked NMI is not serviced a second time, but on the 65C02
+		// it's serviced after the BRK.
+		exp := uint8(0x02)
+		if variant != VariantNMOS {
+			exp = 0x01
+		}
+
+		if core.A != exp || core.PC != 0x8002 {
+			t.Errorf("%d: Incorrect state after return: A:$%02X PC:$%04X", variant, core.A, core.PC)
+		}
+	}
+}
+
+// PLP and RTI drop the pulled bit 4 and force bit 5 set in Phlags.
+func TestPullStatusBreakBits(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_IM, 0xFF,
+		OP_PHA,
+		OP_PLP, // $8003
+		OP_PHP, // $8004
+		OP_PLA,
+		OP_LDA_IM, 0x80, // $8006: return address for RTI
+		OP_PHA,
+		OP_LDA_IM, 0x10,
+		OP_PHA,
+		OP_LDA_IM, 0x30,
+		OP_PHA,
+		OP_RTI,
+		OP_NOP, // $8010
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SP = 0xFD
+
+	if err = core.RunUntil(0x8004, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.Phlags&0x10 != 0 || core.Phlags&0x20 == 0 {
+		t.Errorf("Incorrect status after PLP: Exp:%08b Got:%08b", 0xEF, core.Phlags)
+	}
+
+	if err = core.RunUntil(0x8006, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.A != 0xFF {
+		t.Errorf("Incorrect status pushed by PHP: Exp:%08b Got:%08b", 0xFF, core.A)
+	}
+
+	if err = core.RunUntil(0x8010, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.Phlags != FLAG_IRQ {
+		t.Errorf("Incorrect status after RTI: Exp:%08b Got:%08b", FLAG_IRQ, core.Phlags)
+	}
+}
+
+// Interrupts set I outside of an instruction, and the change is still
+// reported.
+func TestInterruptFlagChange(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_NOP, OP_RTI}, 0x8001, 0x8000, 0x8001)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SP = 0xFD
+
+	changes := []string{}
+	core.FlagHook = func(c *Core, pc uint16, flag uint8, oldValue, newValue bool) {
+		changes = append(changes, fmt.Sprintf("$%04X %02X %t->%t", pc, flag, oldValue, newValue))
+	}
+
+	buf := &bytes.Buffer{}
+	core.Debug = true
+	core.DebugFile = buf
+	core.TraceFlags = true
+	core.TraceLevel = TraceMnemonic
+
+	if !core.IRQ() {
+		t.Fatal("IRQ not serviced")
+	}
+
+	// RTI clears I again, then a raised NMI sets it before the next RTI.
+	if err = core.Step(); err != nil {
+		t.Fatal(err)
+	}
+	core.RaiseNMI()
+	if err = core.Step(); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{
+		"$8000 04 false->true",
+		"$8001 04 true->false",
+		"$8000 04 false->true",
+		"$8001 04 true->false",
+	}
+	if strings.Join(changes, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("Incorrect flag changes:\nExp:%q\nGot:%q", exp, changes)
+	}
+
+	expTrace := "[000000] $8000: flag I set\n" +
+		"[000001] $8001: RTI\n" +
+		"[000001] $8001: flag I cleared\n" +
+		"[000001] $8000: flag I set\n" +
+		"[000002] $8001: RTI\n" +
+		"[000002] $8001: flag I cleared\n"
+	if buf.String() != expTrace {
+		t.Errorf("Incorrect trace:\nExp:%q\nGot:%q", expTrace, buf.String())
+	}
+}
@@ -0,0 +1,148 @@
+package emu
+
+import (
+	"io"
+)
+
+// ReadHandler returns the value for a read from a memory-mapped address.
+type ReadHandler func(addr uint16) uint8
+
+// WriteHandler receives a write to a memory-mapped address.
+type WriteHandler func(addr uint16, value uint8)
+
+type readMapping struct {
+	start, end uint16
+	fn         ReadHandler
+}
+
+type writeMapping struct {
+	start, end uint16
+	fn         WriteHandler
+}
+
+// MapRead sends reads from start through end, inclusive, to fn instead of
+// the normal memory map.  Reads from a mapped address count as register
+// polling for the stuck detector.  Later mappings take priority over
+// earlier ones that overlap.
+func (c *Core) MapRead(start, end uint16, fn ReadHandler) {
+	c.readHandlers = append(c.readHandlers, readMapping{start, end, fn})
+}
+
+// MapWrite sends writes to start through end, inclusive, to fn instead of
+// the normal memory map.  Later mappings take priority over earlier ones
+// that overlap.
+func (c *Core) MapWrite(start, end uint16, fn WriteHandler) {
+	c.writeHandlers = append(c.writeHandlers, writeMapping{start, end, fn})
+}
+
+func (c *Core) readHandler(addr uint16) ReadHandler {
+	for i := len(c.readHandlers) - 1; i >= 0; i-- {
+		m := c.readHandlers[i]
+		if addr >= m.start && addr <= m.end {
+			return m.fn
+		}
+	}
+	return nil
+}
+
+func (c *Core) writeHandler(addr uint16) WriteHandler {
+	for i := len(c.writeHandlers) - 1; i >= 0; i-- {
+		m := c.writeHandlers[i]
+		if addr >= m.start && addr <= m.end {
+			return m.fn
+		}
+	}
+	return nil
+}
+
+// MapCharOutput writes each byte stored to addr to w, like the character
+// output register of a serial port or terminal.  Write errors are ignored.
+func (c *Core) MapCharOutput(addr uint16, w io.Writer) {
+	c.MapWrite(addr, addr, func(addr uint16, value uint8) {
+		w.Write([]byte{value})
+	})
+}
+
+// MapCharInput returns the next byte from r for each read from addr, like
+// the character input register of a serial port or terminal.  Once r is
+// exhausted or returns an error, reads return eof.
+func (c *Core) MapCharInput(addr uint16, r io.Reader, eof uint8) {
+	buf := make([]byte, 1)
+	c.MapRead(addr, addr, func(addr uint16) uint8 {
+		if n, _ := r.Read(buf); n == 0 {
+			return eof
+		}
+		return buf[0]
+	})
+}
+
+// MemoryType is the kind of storage behind a MemoryRegion.
+type MemoryType int
+
+const (
+	MemRAM     MemoryType = iota // main RAM, or all of memory for a full RW core
+	MemWRAM                      // banked work RAM at $6000-$7FFF
+	MemROM                       // ROM, possibly mirrored or banked
+	MemOpenBus                   // nothing; reads return the open bus value
+	MemMMIO                      // read or write handler
+)
+
+func (t MemoryType) String() string {
+	switch t {
+	case MemRAM:
+		return "RAM"
+	case MemWRAM:
+		return "WRAM"
+	case MemROM:
+		return "ROM"
+	case MemOpenBus:
+		return "open bus"
+	case MemMMIO:
+		return "MMIO"
+	}
+	return "unknown"
+}
+
+// MemoryRegion is a range of addresses, inclusive, backed by the same type
+// of memory.
+type MemoryRegion struct {
+	Start uint16
+	End   uint16
+	Type  MemoryType
+}
+
+// MemoryRegions returns the current memory map as a sorted list of regions
+// covering all 64k.  Addresses with a read or write handler are MMIO, taking
+// priority over whatever is underneath.
+func (c *Core) MemoryRegions() []MemoryRegion {
+	regions := []MemoryRegion{}
+	for addr := 0; addr <= 0xFFFF; addr++ {
+		t := c.memoryType(uint16(addr))
+		if last := len(regions) - 1; last >= 0 && regions[last].Type == t {
+			regions[last].End = uint16(addr)
+			continue
+		}
+		regions = append(regions, MemoryRegion{Start: uint16(addr), End: uint16(addr), Type: t})
+	}
+	return regions
+}
+
+func (c *Core) memoryType(addr uint16) MemoryType {
+	if c.readHandler(addr) != nil || c.writeHandler(addr) != nil {
+		return MemMMIO
+	}
+
+	switch {
+	case c.romSegment(addr) != nil:
+		return MemROM
+	case c.fullRW:
+		return MemRAM
+	case addr < 0x1000:
+		return MemRAM
+	case addr >= 0x8000:
+		return MemROM
+	case addr >= 0x6000 && c.wram != nil:
+		return MemWRAM
+	}
+	return MemOpenBus
+}
@@ -0,0 +1,276 @@
+package emu
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestMapReadWrite(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_AB, 0x00, 0x20,
+		OP_STA_AB, 0x01, 0x20,
+		OP_STA_AB, 0x00, 0x03,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	written := []uint8{}
+	core.MapRead(0x2000, 0x2000, func(addr uint16) uint8 { return 0x5A })
+	core.MapWrite(0x2001, 0x2001, func(addr uint16, value uint8) {
+		written = append(written, value)
+	})
+
+	// A handler covering RAM replaces the normal storage.
+	core.MapWrite(0x0300, 0x0300, func(addr uint16, value uint8) {})
+
+	for i := 0; i < 3; i++ {
+		if err = core.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if core.A != 0x5A {
+		t.Errorf("Incorrect A: Exp:$5A Got:$%02X", core.A)
+	}
+
+	if len(written) != 1 || written[0] != 0x5A {
+		t.Errorf("Incorrect writes: Exp:[90] Got:%v", written)
+	}
+
+	if core.memory[0x0300] != 0x00 {
+		t.Errorf("Mapped write reached RAM")
+	}
+}
+
+func TestRMWDoubleWrite(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_INC_AB, 0x00, 0x20}, 0x8000, 0x8000, 0x8000)
+
+	tests := []struct {
+		name string
+		opts []Option
+		exp  []uint8
+	}{
+		{"NMOS", nil, []uint8{0x42}},
+		{"NMOS DummyWrites", []Option{DummyWrites()}, []uint8{0x41, 0x42}},
+		{"65C02 DummyWrites", []Option{DummyWrites(), CPUVariant(Variant65C02)}, []uint8{0x42}},
+	}
+
+	for _, tc := range tests {
+		core, err := NewCore(rom, false, 0, tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		written := []uint8{}
+		core.MapRead(0x2000, 0x2000, func(addr uint16) uint8 { return 0x41 })
+		core.MapWrite(0x2000, 0x2000, func(addr uint16, value uint8) {
+			written = append(written, value)
+		})
+
+		if err = core.Step(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(written, tc.exp) {
+			t.Errorf("%s: Incorrect writes: Exp:%v Got:%v", tc.name, tc.exp, written)
+		}
+	}
+}
+
+// A write-only register over RAM.  The read handler stands in for what the
+// hardware returns, and the RAM underneath is never touched.
+func TestRMWWriteOnlyRegister(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_INC_AB, 0x01, 0xF0,
+		OP_ASL_AB, 0x01, 0xF0,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewRWCore(romAt(rom, 0x8000), 0, DummyWrites())
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.rom[0xF001] = 0x99
+
+	written := []uint8{}
+	core.MapRead(0xF001, 0xF001, func(addr uint16) uint8 { return 0x10 })
+	core.MapWrite(0xF001, 0xF001, func(addr uint16, value uint8) {
+		written = append(written, value)
+	})
+
+	if err = core.RunUntil(0x8006, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []uint8{0x10, 0x11, 0x10, 0x20}
+	if !bytes.Equal(written, exp) {
+		t.Errorf("Incorrect writes: Exp:%v Got:%v", exp, written)
+	}
+
+	if core.rom[0xF001] != 0x99 {
+		t.Errorf("RAM under the register was modified: $%02X", core.rom[0xF001])
+	}
+}
+
+func TestMapCharOutput(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_IM, 'H',
+		OP_STA_AB, 0x01, 0xF0,
+		OP_LDA_IM, 'I',
+		OP_STA_AB, 0x01, 0xF0,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewRWCore(romAt(rom, 0x8000), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	core.MapCharOutput(0xF001, out)
+
+	if err = core.RunUntil(0x800A, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != "HI" {
+		t.Errorf("Incorrect output: Exp:%q Got:%q", "HI", out.String())
+	}
+
+	if core.ReadByte(0xF001) != 0x00 {
+		t.Errorf("Mapped write reached memory")
+	}
+}
+
+// romAt places rom into a 64k image at addr for use with NewRWCore.
+func romAt(rom []byte, addr uint16) []byte {
+	mem := make([]byte, 0x10000)
+	copy(mem[addr:], rom)
+	mem[VECTOR_RESET] = byte(addr)
+	mem[VECTOR_RESET+1] = byte(addr >> 8)
+	return mem
+}
+
+func TestMapCharInput(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_AB, 0x00, 0xF0,
+		OP_LDX_AB, 0x00, 0xF0,
+		OP_LDY_AB, 0x00, 0xF0,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewRWCore(romAt(rom, 0x8000), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	core.MapCharInput(0xF000, strings.NewReader("ok"), 0xFF)
+
+	if err = core.RunUntil(0x8009, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.A != 'o' || core.X != 'k' {
+		t.Errorf("Incorrect input: Exp:\"ok\" Got:%q", []byte{core.A, core.X})
+	}
+
+	if core.Y != 0xFF {
+		t.Errorf("Incorrect EOF value: Exp:$FF Got:$%02X", core.Y)
+	}
+}
+
+func TestPokeByte(t *testing.T) {
+	core, err := NewCore(PadWithVectors([]byte{OP_NOP}, 0x8000, 0x8000, 0x8000), false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writes := 0
+	core.MapWrite(0x0200, 0x02FF, func(addr uint16, value uint8) {
+		writes++
+	})
+
+	core.WriteByte(0x0300, 0x01)
+	core.PokeByte(0x0234, 0x99)
+
+	if writes != 0 {
+		t.Errorf("Poke called a write handler")
+	}
+
+	if core.memory[0x0234] != 0x99 {
+		t.Errorf("Incorrect value in RAM: Exp:$99 Got:$%02X", core.memory[0x0234])
+	}
+
+	if core.LastWriteAddr() != 0x0300 {
+		t.Errorf("Poke changed the last write address: $%04X", core.LastWriteAddr())
+	}
+
+	core.WriteByte(0x0234, 0x11)
+	if writes != 1 || core.memory[0x0234] != 0x99 {
+		t.Errorf("WriteByte did not go through the handler")
+	}
+
+	core.PokeByte(0x8010, 0xAB)
+	if core.PeekByte(0x8010) != 0xAB {
+		t.Errorf("Poke did not write to ROM")
+	}
+}
+
+func TestMemoryRegions(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_NOP}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkRegions(t, "default", core.MemoryRegions(), []MemoryRegion{
+		{0x0000, 0x0FFF, MemRAM},
+		{0x1000, 0x7FFF, MemOpenBus},
+		{0x8000, 0xFFFF, MemROM},
+	})
+
+	core, err = NewCore(rom, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.MapCharOutput(0x2001, ioutil.Discard)
+	core.MapRead(0x0400, 0x04FF, func(addr uint16) uint8 { return 0 })
+
+	checkRegions(t, "WRAM and MMIO", core.MemoryRegions(), []MemoryRegion{
+		{0x0000, 0x03FF, MemRAM},
+		{0x0400, 0x04FF, MemMMIO},
+		{0x0500, 0x0FFF, MemRAM},
+		{0x1000, 0x2000, MemOpenBus},
+		{0x2001, 0x2001, MemMMIO},
+		{0x2002, 0x5FFF, MemOpenBus},
+		{0x6000, 0x7FFF, MemWRAM},
+		{0x8000, 0xFFFF, MemROM},
+	})
+
+	rw, err := NewRWCore(romAt(rom, 0x8000), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkRegions(t, "RW core", rw.MemoryRegions(), []MemoryRegion{
+		{0x0000, 0xFFFF, MemRAM},
+	})
+}
+
+func checkRegions(t *testing.T, name string, got, exp []MemoryRegion) {
+	t.Helper()
+
+	if len(got) != len(exp) {
+		t.Errorf("%s: Incorrect regions:\nExp:%v\nGot:%v", name, exp, got)
+		return
+	}
+
+	for i := range exp {
+		if got[i] != exp[i] {
+			t.Errorf("%s: Incorrect region %d: Exp:%v Got:%v", name, i, exp[i], got[i])
+		}
+	}
+}
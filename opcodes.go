@@ -365,3 +365,119 @@ const (
 	OP_INC_AX byte = 0xFE //Absolute,X
 	OP_SBC_IY byte = 0xF1 //(Indirect),Y
 )
+
+/*
+   Undocumented NMOS opcodes.  These are only decoded when illegal
+   opcodes are enabled on the core.
+*/
+const (
+	OP_SAX_IX byte = 0x83 //(Indirect,X)
+	OP_SAX_ZP byte = 0x87 //Zero Page
+	OP_SAX_AB byte = 0x8F //Absolute
+	OP_SAX_ZY byte = 0x97 //Zero Page,Y
+	OP_LAX_IX byte = 0xA3 //(Indirect,X)
+	OP_LAX_ZP byte = 0xA7 //Zero Page
+	OP_LAX_AB byte = 0xAF //Absolute
+	OP_LAX_IY byte = 0xB3 //(Indirect),Y
+	OP_LAX_ZY byte = 0xB7 //Zero Page,Y
+	OP_LAX_AY byte = 0xBF //Absolute,Y
+	OP_ISC_IX byte = 0xE3 //(Indirect,X)
+	OP_ISC_ZP byte = 0xE7 //Zero Page
+	OP_ISC_AB byte = 0xEF //Absolute
+	OP_ISC_IY byte = 0xF3 //(Indirect),Y
+	OP_ISC_ZX byte = 0xF7 //Zero Page,X
+	OP_ISC_AY byte = 0xFB //Absolute,Y
+	OP_ISC_AX byte = 0xFF //Absolute,X
+
+	// NOPs that still consume their operand bytes.
+	OP_NOP_1A byte = 0x1A //Implied
+	OP_NOP_3A byte = 0x3A //Implied
+	OP_NOP_5A byte = 0x5A //Implied
+	OP_NOP_7A byte = 0x7A //Implied
+	OP_NOP_DA byte = 0xDA //Implied
+	OP_NOP_FA byte = 0xFA //Implied
+	OP_NOP_80 byte = 0x80 //Immediate
+	OP_NOP_82 byte = 0x82 //Immediate
+	OP_NOP_89 byte = 0x89 //Immediate
+	OP_NOP_C2 byte = 0xC2 //Immediate
+	OP_NOP_E2 byte = 0xE2 //Immediate
+	OP_NOP_04 byte = 0x04 //Zero Page
+	OP_NOP_44 byte = 0x44 //Zero Page
+	OP_NOP_64 byte = 0x64 //Zero Page
+	OP_NOP_14 byte = 0x14 //Zero Page,X
+	OP_NOP_34 byte = 0x34 //Zero Page,X
+	OP_NOP_54 byte = 0x54 //Zero Page,X
+	OP_NOP_74 byte = 0x74 //Zero Page,X
+	OP_NOP_D4 byte = 0xD4 //Zero Page,X
+	OP_NOP_F4 byte = 0xF4 //Zero Page,X
+	OP_NOP_0C byte = 0x0C //Absolute
+	OP_NOP_1C byte = 0x1C //Absolute,X
+	OP_NOP_3C byte = 0x3C //Absolute,X
+	OP_NOP_5C byte = 0x5C //Absolute,X
+	OP_NOP_7C byte = 0x7C //Absolute,X
+	OP_NOP_DC byte = 0xDC //Absolute,X
+	OP_NOP_FC byte = 0xFC //Absolute,X
+)
+
+/*
+   65C02 opcodes.  These are only decoded by the 65C02 variant.
+*/
+const (
+	OP_ORA_IZ byte = 0x12 //(Zero Page)
+	OP_AND_IZ byte = 0x32 //(Zero Page)
+	OP_EOR_IZ byte = 0x52 //(Zero Page)
+	OP_ADC_IZ byte = 0x72 //(Zero Page)
+	OP_STA_IZ byte = 0x92 //(Zero Page)
+	OP_LDA_IZ byte = 0xB2 //(Zero Page)
+	OP_CMP_IZ byte = 0xD2 //(Zero Page)
+	OP_SBC_IZ byte = 0xF2 //(Zero Page)
+
+	OP_JMP_AX byte = 0x7C //(Absolute,X)
+)
+
+/*
+   Rockwell 65C02 bit instructions.  These are decoded by the Rockwell and WDC
+   variants.
+*/
+const (
+	OP_RMB0 byte = 0x07 //Zero Page
+	OP_RMB1 byte = 0x17 //Zero Page
+	OP_RMB2 byte = 0x27 //Zero Page
+	OP_RMB3 byte = 0x37 //Zero Page
+	OP_RMB4 byte = 0x47 //Zero Page
+	OP_RMB5 byte = 0x57 //Zero Page
+	OP_RMB6 byte = 0x67 //Zero Page
+	OP_RMB7 byte = 0x77 //Zero Page
+	OP_SMB0 byte = 0x87 //Zero Page
+	OP_SMB1 byte = 0x97 //Zero Page
+	OP_SMB2 byte = 0xA7 //Zero Page
+	OP_SMB3 byte = 0xB7 //Zero Page
+	OP_SMB4 byte = 0xC7 //Zero Page
+	OP_SMB5 byte = 0xD7 //Zero Page
+	OP_SMB6 byte = 0xE7 //Zero Page
+	OP_SMB7 byte = 0xF7 //Zero Page
+	OP_BBR0 byte = 0x0F //Zero Page,Relative
+	OP_BBR1 byte = 0x1F //Zero Page,Relative
+	OP_BBR2 byte = 0x2F //Zero Page,Relative
+	OP_BBR3 byte = 0x3F //Zero Page,Relative
+	OP_BBR4 byte = 0x4F //Zero Page,Relative
+	OP_BBR5 byte = 0x5F //Zero Page,Relative
+	OP_BBR6 byte = 0x6F //Zero Page,Relative
+	OP_BBR7 byte = 0x7F //Zero Page,Relative
+	OP_BBS0 byte = 0x8F //Zero Page,Relative
+	OP_BBS1 byte = 0x9F //Zero Page,Relative
+	OP_BBS2 byte = 0xAF //Zero Page,Relative
+	OP_BBS3 byte = 0xBF //Zero Page,Relative
+	OP_BBS4 byte = 0xCF //Zero Page,Relative
+	OP_BBS5 byte = 0xDF //Zero Page,Relative
+	OP_BBS6 byte = 0xEF //Zero Page,Relative
+	OP_BBS7 byte = 0xFF //Zero Page,Relative
+)
+
+/*
+   WDC 65C02 instructions.  These are only decoded by the WDC variant.
+*/
+const (
+	OP_WAI byte = 0xCB //Implied
+	OP_STP byte = 0xDB //Implied
+)
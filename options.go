@@ -0,0 +1,227 @@
+package emu
+
+import (
+	"math/rand"
+)
+
+// Option configures a Core during construction.
+type Option func(c *Core)
+
+// ValidateResetVector makes the constructor return ErrBadResetVector if the
+// reset vector doesn't point into ROM.  A blank vector of $0000 would
+// otherwise start execution in RAM.
+func ValidateResetVector() Option {
+	return func(c *Core) {
+		c.validateReset = true
+	}
+}
+
+// TrackCoverage records which bytes are executed as part of an instruction.
+// See Core.Coverage.
+func TrackCoverage() Option {
+	return func(c *Core) {
+		c.coverage = make([]bool, 0x10000)
+	}
+}
+
+// CountOpcodes counts how many times each opcode is executed.  See
+// Core.OpcodeCounts.
+func CountOpcodes() Option {
+	return func(c *Core) {
+		c.opcodeCounts = make(map[byte]uint64)
+	}
+}
+
+// StrictBCD makes ADC and SBC in decimal mode stop the run with
+// ErrInvalidBCD if either A or the operand has a nibble above 9.  NMOS
+// results for invalid BCD are quirky and usually point to a bug in the
+// program.
+func StrictBCD() Option {
+	return func(c *Core) {
+		c.strictBCD = true
+	}
+}
+
+// Variant selects the CPU model to emulate.
+type Variant int
+
+const (
+	VariantNMOS     Variant = iota // original NMOS 6502
+	Variant65C02                   // CMOS 65C02
+	VariantRockwell                // 65C02 with the Rockwell bit instructions
+	VariantWDC                     // WDC 65C02 with the Rockwell bit instructions, WAI, and STP
+)
+
+// CPUVariant selects the CPU model.  The default is VariantNMOS.
+func CPUVariant(v Variant) Option {
+	return func(c *Core) {
+		c.variant = v
+	}
+}
+
+// DummyReads makes Absolute,X, Absolute,Y, and (Indirect),Y addressing
+// read from the address with the uncarried high byte when the index crosses
+// a page, like the NMOS 6502.  This matters when the extra read hits a
+// memory-mapped register.
+func DummyReads() Option {
+	return func(c *Core) {
+		c.dummyReads = true
+	}
+}
+
+// DummyWrites makes read-modify-write instructions write the unmodified
+// value back before writing the result, like the NMOS 6502.  Memory-mapped
+// registers see both writes.  The 65C02 variants do a second read instead,
+// so this has no effect on them.
+func DummyWrites() Option {
+	return func(c *Core) {
+		c.dummyWrites = true
+	}
+}
+
+// LogAccesses keeps the last size memory accesses.  See Core.AccessLog.
+func LogAccesses(size int) Option {
+	return func(c *Core) {
+		if size > 0 {
+			c.accessLog = make([]MemAccess, size)
+		}
+	}
+}
+
+// StrictROMSize makes NewCore return an error for a ROM that isn't a
+// multiple of 256 bytes instead of padding it.
+func StrictROMSize() Option {
+	return func(c *Core) {
+		c.strictROM = true
+	}
+}
+
+// HaltOn makes the core stop the run when it fetches opcode, instead of
+// executing it.  This is a quick sentinel for test programs, like a trap
+// that halts.  Core.HaltOpcode can be changed later to pick another byte.
+func HaltOn(opcode uint8) Option {
+	return func(c *Core) {
+		c.HaltOpcode = opcode
+		c.haltOn = true
+	}
+}
+
+// ROMWritePolicy is what happens when a program writes to ROM.
+type ROMWritePolicy int
+
+const (
+	ROMWriteIgnore ROMWritePolicy = iota // drop the write, like the hardware
+	ROMWriteLog                          // drop the write and log it to DebugFile or stdout
+	ROMWriteError                        // stop the run with ErrROMWrite
+)
+
+// ROMWrites sets the policy for writes to ROM at $8000-$FFFF.  The default
+// is ROMWriteIgnore.  A write to ROM is usually a pointer bug in the program.
+// This has no effect on cores from NewRWCore, which have no ROM.
+func ROMWrites(policy ROMWritePolicy) Option {
+	return func(c *Core) {
+		c.romWrites = policy
+	}
+}
+
+// ROMFill sets the byte used to pad a ROM that isn't a multiple of 256
+// bytes.  The default is $FF.
+func ROMFill(fill uint8) Option {
+	return func(c *Core) {
+		c.romFill = fill
+	}
+}
+
+// WRAMBanks enables banked WRAM with the given number of 8k banks.  See
+// Core.SetWRAMBank.
+func WRAMBanks(count int) Option {
+	return func(c *Core) {
+		c.wram = make([]byte, count*0x2000)
+	}
+}
+
+// InitialState holds the starting register values for the StartState
+// option.
+type InitialState struct {
+	A      uint8
+	X      uint8
+	Y      uint8
+	SP     uint8
+	Phlags uint8
+
+	// Starting address.  When non-zero it's used instead of the reset
+	// vector, which is then never read.
+	PC uint16
+}
+
+// StartState sets the registers to s at construction instead of zero.
+func StartState(s InitialState) Option {
+	return func(c *Core) {
+		c.A = s.A
+		c.X = s.X
+		c.Y = s.Y
+		c.SP = s.SP
+		c.Phlags = s.Phlags
+		if s.PC != 0 {
+			StartPC(s.PC)(c)
+		}
+	}
+}
+
+// StartPC starts execution at pc instead of the address in the reset
+// vector.  The vector is never read, so it can be mapped to a handler or
+// trap without side effects at construction.
+func StartPC(pc uint16) Option {
+	return func(c *Core) {
+		c.startPC = pc
+		c.hasStartPC = true
+	}
+}
+
+// RAMPattern is the power-on contents of RAM for the RAMInit option.
+type RAMPattern int
+
+const (
+	RAMZero        RAMPattern = iota // all $00
+	RAMOnes                          // all $FF
+	RAMAlternating                   // $00, $FF, $00, $FF...
+	RAMRandom                        // pseudo-random bytes
+)
+
+// RAMInit fills main RAM with the given pattern at construction instead of
+// zeros.  This is for catching programs that depend on uninitialized
+// memory.  RAMRandom always produces the same contents for a given seed;
+// see RAMSeed.
+func RAMInit(pattern RAMPattern) Option {
+	return func(c *Core) {
+		c.ramPattern = pattern
+	}
+}
+
+// RAMSeed fills main RAM with pseudo-random bytes generated from seed.  The
+// same seed always gives the same contents.  RAMInit(RAMRandom) uses a seed
+// of 1.
+func RAMSeed(seed int64) Option {
+	return func(c *Core) {
+		c.ramPattern = RAMRandom
+		c.ramSeed = seed
+	}
+}
+
+// fillRAM applies the RAMInit pattern to main RAM.
+func (c *Core) fillRAM() {
+	switch c.ramPattern {
+	case RAMOnes:
+		for i := range c.memory {
+			c.memory[i] = 0xFF
+		}
+	case RAMAlternating:
+		for i := range c.memory {
+			if i%2 == 1 {
+				c.memory[i] = 0xFF
+			}
+		}
+	case RAMRandom:
+		rand.New(rand.NewSource(c.ramSeed)).Read(c.memory)
+	}
+}
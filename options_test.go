@@ -0,0 +1,263 @@
+package emu
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestValidateResetVector(t *testing.T) {
+	blank := PadWithVectors([]byte{OP_NOP}, 0x0000, 0x0000, 0x0000)
+	valid := PadWithVectors([]byte{OP_NOP}, 0x8000, 0x8000, 0x8000)
+
+	_, err := NewCore(blank, false, 0, ValidateResetVector())
+	if !errors.Is(err, ErrBadResetVector) {
+		t.Errorf("Expected ErrBadResetVector, got: %v", err)
+	}
+
+	// Validation is opt-in
+	_, err = NewCore(blank, false, 0)
+	if err != nil {
+		t.Errorf("Unexpected error without validation: %v", err)
+	}
+
+	_, err = NewCore(valid, false, 0, ValidateResetVector())
+	if err != nil {
+		t.Errorf("Unexpected error with a valid vector: %v", err)
+	}
+}
+
+func TestRAMInit(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_NOP}, 0x8000, 0x8000, 0x8000)
+
+	tests := []struct {
+		name    string
+		pattern RAMPattern
+		check   func(i int, b byte) bool
+	}{
+		{"zero", RAMZero, func(i int, b byte) bool { return b == 0x00 }},
+		{"ones", RAMOnes, func(i int, b byte) bool { return b == 0xFF }},
+		{"alternating", RAMAlternating, func(i int, b byte) bool {
+			if i%2 == 0 {
+				return b == 0x00
+			}
+			return b == 0xFF
+		}},
+	}
+
+	for _, tc := range tests {
+		core, err := NewCore(rom, false, 0, RAMInit(tc.pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, b := range core.memory {
+			if !tc.check(i, b) {
+				t.Errorf("%s: Incorrect value at $%04X: $%02X", tc.name, i, b)
+				break
+			}
+		}
+	}
+
+	core, err := NewCore(rom, false, 0, RAMInit(RAMRandom))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := NewCore(rom, false, 0, RAMInit(RAMRandom))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(core.memory, other.memory) {
+		t.Errorf("Random fill is not deterministic")
+	}
+
+	// Not much of a random fill if every byte is the same.
+	counts := map[byte]int{}
+	for _, b := range core.memory {
+		counts[b]++
+	}
+	if len(counts) < 128 {
+		t.Errorf("Random fill only has %d distinct values", len(counts))
+	}
+}
+
+func TestRAMSeed(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_NOP}, 0x8000, 0x8000, 0x8000)
+
+	newMem := func(opts ...Option) []byte {
+		core, err := NewCore(rom, false, 0, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return core.memory
+	}
+
+	if !bytes.Equal(newMem(RAMSeed(42)), newMem(RAMSeed(42))) {
+		t.Errorf("Same seed gave different RAM")
+	}
+
+	if bytes.Equal(newMem(RAMSeed(42)), newMem(RAMSeed(43))) {
+		t.Errorf("Different seeds gave the same RAM")
+	}
+
+	if !bytes.Equal(newMem(RAMSeed(1)), newMem(RAMInit(RAMRandom))) {
+		t.Errorf("RAMInit(RAMRandom) doesn't match seed 1")
+	}
+}
+
+func TestStartState(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_ADC_IM, 0x01,
+		OP_PHA,
+		0xFF,
+		OP_NOP, // $8004, the reset vector
+	}, 0x8000, 0x8004, 0x8000)
+
+	state := InitialState{
+		A:      0x05,
+		X:      0x12,
+		Y:      0x34,
+		SP:     0xFD,
+		Phlags: FLAG_CARRY,
+		PC:     0x8000,
+	}
+
+	core, err := NewCore(rom, false, 0, StartState(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SetTrap(0xFF, haltTrap)
+
+	if err = core.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := Registers{A: 0x07, X: 0x12, Y: 0x34, PC: 0x8003, SP: 0xFC}
+	if core.Registers() != exp {
+		t.Errorf("Incorrect registers:\nExp:%+v\nGot:%+v", exp, core.Registers())
+	}
+
+	if core.memory[0x01FD] != 0x07 {
+		t.Errorf("Incorrect stack value: $%02X", core.memory[0x01FD])
+	}
+
+	// Without a PC the reset vector is still used.
+	core, err = NewCore(rom, false, 0, StartState(InitialState{SP: 0xFD}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if core.PC != 0x8004 || core.SP != 0xFD {
+		t.Errorf("Incorrect start: PC:$%04X SP:$%02X", core.PC, core.SP)
+	}
+}
+
+func TestStartPC(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_NOP}, 0x8000, 0x8000, 0x8000)
+
+	vectorReads := 0
+	trapVectors := func(c *Core) {
+		c.MapRead(VECTOR_RESET, VECTOR_RESET+1, func(addr uint16) uint8 {
+			vectorReads++
+			return 0x00
+		})
+	}
+
+	for _, pc := range []uint16{0x0000, 0x1234} {
+		core, err := NewRWCore(romAt(rom, 0x8000), 0, trapVectors, StartPC(pc))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if core.PC != pc {
+			t.Errorf("Incorrect PC: Exp:$%04X Got:$%04X", pc, core.PC)
+		}
+	}
+
+	if vectorReads != 0 {
+		t.Errorf("Reset vector was read %d times", vectorReads)
+	}
+
+	// Validation only applies to the reset vector.
+	_, err := NewCore(PadWithVectors([]byte{OP_NOP}, 0, 0, 0), false, 0, ValidateResetVector(), StartPC(0x0400))
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestROMWrites(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_IM, 0x42,
+		OP_STA_AB, 0x34, 0x92,
+		0xFF,
+	}, 0x8000, 0x8000, 0x8000)
+
+	tests := []struct {
+		policy ROMWritePolicy
+		log    string
+		err    error
+	}{
+		{ROMWriteIgnore, "", nil},
+		{ROMWriteLog, "[$8002] write to ROM: $9234 = $42\n", nil},
+		{ROMWriteError, "", ErrROMWrite},
+	}
+
+	for _, tc := range tests {
+		core, err := NewCore(rom, false, 10, ROMWrites(tc.policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		core.SetTrap(0xFF, haltTrap)
+
+		buf := &bytes.Buffer{}
+		core.DebugFile = buf
+		core.TraceLevel = TraceOff
+
+		err = core.Run()
+		if !errors.Is(err, tc.err) {
+			t.Errorf("Policy %d: Incorrect error: Exp:%v Got:%v", tc.policy, tc.err, err)
+		}
+
+		if buf.String() != tc.log {
+			t.Errorf("Policy %d: Incorrect log: Exp:%q Got:%q", tc.policy, tc.log, buf.String())
+		}
+
+		if core.PeekByte(0x9234) != rom[0x1234%len(rom)] {
+			t.Errorf("Policy %d: ROM was modified", tc.policy)
+		}
+
+		if tc.err != nil && core.PC != 0x8005 {
+			t.Errorf("Policy %d: Run did not stop after the write: $%04X", tc.policy, core.PC)
+		}
+	}
+}
+
+func TestHaltOn(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_NOP, OP_NOP, 0x02}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0, HaltOn(0x02))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = core.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !core.Halted() || core.PC != 0x8002 {
+		t.Errorf("Did not halt: halted:%t PC:$%04X", core.Halted(), core.PC)
+	}
+
+	// Setting the field alone doesn't enable it, and $02 jams.
+	core, err = NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.HaltOpcode = 0x02
+
+	if err = core.Run(); !errors.Is(err, ErrJammed) {
+		t.Errorf("Expected ErrJammed without HaltOn, got %v", err)
+	}
+}
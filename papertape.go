@@ -0,0 +1,76 @@
+package emu
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// LoadPaperTape parses a MOS paper tape file, as used by the KIM-1 and
+// SYM-1, into a 64k image for NewRWCore.  Each record is a semicolon, a
+// byte count, a two byte address, the data, and a 16-bit sum of all of the
+// preceding bytes.  The last record has a count of zero and holds the
+// number of records in place of the address.
+//
+// The format has no start address, so the address of the first data record
+// is returned as the entry point.
+func LoadPaperTape(r io.Reader) ([]byte, uint16, error) {
+	image := make([]byte, 0x10000)
+	var entry uint16
+	records := 0
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		if text[0] != ';' {
+			return nil, 0, fmt.Errorf("paper tape line %d: missing start code", line)
+		}
+
+		rec, err := hex.DecodeString(text[1:])
+		if err != nil {
+			return nil, 0, fmt.Errorf("paper tape line %d: %v", line, err)
+		}
+
+		if len(rec) < 5 || len(rec) != int(rec[0])+5 {
+			return nil, 0, fmt.Errorf("paper tape line %d: bad record length", line)
+		}
+
+		var sum uint16
+		for _, b := range rec[:len(rec)-2] {
+			sum += uint16(b)
+		}
+		if sum != uint16(rec[len(rec)-2])<<8|uint16(rec[len(rec)-1]) {
+			return nil, 0, fmt.Errorf("paper tape line %d: checksum mismatch", line)
+		}
+
+		addr := uint16(rec[1])<<8 | uint16(rec[2])
+		if rec[0] == 0 {
+			if int(addr) != records {
+				return nil, 0, fmt.Errorf("paper tape line %d: record count mismatch: Exp:%d Got:%d", line, addr, records)
+			}
+			return image, entry, nil
+		}
+
+		if records == 0 {
+			entry = addr
+		}
+		records++
+
+		if err := copyImage(image, uint32(addr), rec[3:len(rec)-2]); err != nil {
+			return nil, 0, fmt.Errorf("paper tape line %d: %v", line, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	return nil, 0, fmt.Errorf("paper tape: missing last record")
+}
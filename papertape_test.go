@@ -0,0 +1,57 @@
+package emu
+
+import (
+	"strings"
+	"testing"
+)
+
+const testPaperTape = `;050200A9428510FF0286
+;030210010203001B
+;0000020002
+`
+
+func TestLoadPaperTape(t *testing.T) {
+	image, entry, err := LoadPaperTape(strings.NewReader(testPaperTape))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry != 0x0200 {
+		t.Errorf("Incorrect entry point: Exp:$0200 Got:$%04X", entry)
+	}
+
+	exp := []byte{0xA9, 0x42, 0x85, 0x10, 0xFF}
+	for i, b := range exp {
+		if image[0x0200+i] != b {
+			t.Errorf("Incorrect byte at $%04X: Exp:$%02X Got:$%02X", 0x0200+i, b, image[0x0200+i])
+		}
+	}
+
+	if image[0x0212] != 0x03 {
+		t.Errorf("Incorrect byte at $0212: Exp:$03 Got:$%02X", image[0x0212])
+	}
+}
+
+func TestLoadPaperTapeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		tape string
+		err  string
+	}{
+		{"checksum", ";050200A9428510FF0287\n;0000010001\n", "checksum"},
+		{"record count", ";050200A9428510FF0286\n;0000020002\n", "record count"},
+		{"no last record", ";050200A9428510FF0286\n", "last record"},
+	}
+
+	for _, tc := range tests {
+		_, _, err := LoadPaperTape(strings.NewReader(tc.tape))
+		if err == nil {
+			t.Errorf("%s: Expected an error", tc.name)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: Incorrect error: %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package emu
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// validateROM checks the size constraints for a ROM used with NewCore.
+func validateROM(rom []byte) error {
+	if len(rom)%256 != 0 {
+		return fmt.Errorf("ROM is not divisible by 256: %d", len(rom))
+	}
+
+	if len(rom) == 0 {
+		return fmt.Errorf("No rom!")
+	}
+	return nil
+}
+
+// loadROM sets the ROM for a core from NewCore.  Unless strict ROM sizes
+// are enabled, a ROM that isn't a multiple of 256 bytes is copied and
+// padded with the fill byte.
+func (c *Core) loadROM(rom []byte) error {
+	if c.strictROM || len(rom) == 0 {
+		if err := validateROM(rom); err != nil {
+			return err
+		}
+	}
+
+	if len(rom)%256 != 0 {
+		padded := make([]byte, (len(rom)/256+1)*256)
+		copy(padded, rom)
+		for i := len(rom); i < len(padded); i++ {
+			padded[i] = c.romFill
+		}
+		rom = padded
+	}
+
+	c.rom = rom
+	return nil
+}
+
+// validateRWROM checks the size constraints for a ROM used with NewRWCore.
+func validateRWROM(rom []byte) error {
+	if len(rom) != 0x10000 {
+		return fmt.Errorf("ROM must be exactly 64k (%X)", len(rom))
+	}
+	return nil
+}
+
+// LoadROM reads a ROM image from r.  The image can be any non-zero length;
+// NewCore pads a short last page unless StrictROMSize is set.
+func LoadROM(r io.Reader) ([]byte, error) {
+	rom, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rom) == 0 {
+		return nil, fmt.Errorf("No rom!")
+	}
+	return rom, nil
+}
+
+func loadROMFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return LoadROM(file)
+}
+
+// NewCoreFromFile loads a ROM from the given path and passes it to NewCore.
+func NewCoreFromFile(path string, wram bool, instrLimit uint64, opts ...Option) (*Core, error) {
+	rom, err := loadROMFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewCore(rom, wram, instrLimit, opts...)
+}
+
+// NewRWCoreFromFile loads a 64k ROM from the given path and passes it to
+// NewRWCore.
+func NewRWCoreFromFile(path string, instrLimit uint64, opts ...Option) (*Core, error) {
+	rom, err := loadROMFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewRWCore(rom, instrLimit, opts...)
+}
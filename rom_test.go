@@ -0,0 +1,146 @@
+package emu
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLoadROM(t *testing.T) {
+	sizes := []struct {
+		size  int
+		valid bool
+	}{
+		{0, false},
+		{1, true},
+		{255, true},
+		{256, true},
+		{0x4000, true},
+		{0x4001, true},
+		{0x10000, true},
+	}
+
+	for _, s := range sizes {
+		rom, err := LoadROM(bytes.NewReader(make([]byte, s.size)))
+		if s.valid && err != nil {
+			t.Errorf("size %d: Unexpected error: %v", s.size, err)
+		} else if !s.valid && err == nil {
+			t.Errorf("size %d: Expected an error", s.size)
+		}
+
+		if s.valid && len(rom) != s.size {
+			t.Errorf("size %d: Incorrect ROM length: %d", s.size, len(rom))
+		}
+	}
+}
+
+func TestNewCoreFromFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "emu-6502-rom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	rom := PadWithVectors([]byte{OP_NOP}, 0x8000, 0x8000, 0x8000)
+	if _, err = file.Write(rom); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	core, err := NewCoreFromFile(file.Name(), false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if core.PC != 0x8000 {
+		t.Errorf("Incorrect PC: Exp:$8000 Got:$%04X", core.PC)
+	}
+
+	// A single page is not a valid 64k image.
+	_, err = NewRWCoreFromFile(file.Name(), 0)
+	if err == nil {
+		t.Errorf("Expected an error loading a 256 byte ROM into a RW core")
+	}
+
+	_, err = NewCoreFromFile(file.Name()+".missing", false, 0)
+	if err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
+
+func TestShortROM(t *testing.T) {
+	rom := []byte{
+		OP_LDA_IM, 0x05,
+		OP_CLC,
+		OP_ADC_IM, 0x03,
+		OP_STA_ZP, 0x10,
+		OP_LDX_ZP, 0x10,
+		0xEA,
+	}
+
+	core, err := NewCore(rom, false, 0, StartPC(0x8000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SetTrap(0xFF, haltTrap)
+
+	// The padding is $FF, which halts.
+	if err = core.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.X != 0x08 || core.PC != 0x800A {
+		t.Errorf("Incorrect state: X:$%02X PC:$%04X", core.X, core.PC)
+	}
+
+	if len(rom) != 10 {
+		t.Errorf("Caller's ROM was modified")
+	}
+
+	core, err = NewCore(rom, false, 0, StartPC(0x8000), ROMFill(OP_NOP))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if core.PeekByte(0x800A) != OP_NOP || core.PeekByte(0x80FF) != OP_NOP {
+		t.Errorf("Incorrect fill: $%02X", core.PeekByte(0x800A))
+	}
+
+	if _, err = NewCore(rom, false, 0, StrictROMSize()); err == nil {
+		t.Errorf("Expected an error in strict mode")
+	}
+
+	if _, err = NewCore([]byte{}, false, 0); err == nil {
+		t.Errorf("Expected an error for an empty ROM")
+	}
+
+	file, err := ioutil.TempFile("", "emu-6502-rom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err = file.Write(rom); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	core, err = NewCoreFromFile(file.Name(), false, 0, StartPC(0x8000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SetTrap(0xFF, haltTrap)
+
+	if err = core.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.X != 0x08 || core.PC != 0x800A {
+		t.Errorf("Incorrect state from file: X:$%02X PC:$%04X", core.X, core.PC)
+	}
+
+	if _, err = NewCoreFromFile(file.Name(), false, 0, StrictROMSize()); err == nil {
+		t.Errorf("Expected an error in strict mode from file")
+	}
+}
@@ -0,0 +1,53 @@
+package emu
+
+import (
+	"fmt"
+)
+
+// ROMSegment is a ROM image mapped at a fixed address alongside the main
+// ROM, like a character ROM next to the program ROM.
+type ROMSegment struct {
+	Name string
+	Base uint16
+	Data []byte
+}
+
+// End returns the last address covered by the segment.
+func (s ROMSegment) End() uint16 {
+	return s.Base + uint16(len(s.Data)-1)
+}
+
+func (s ROMSegment) contains(addr uint16) bool {
+	return len(s.Data) > 0 && addr >= s.Base && int(addr-s.Base) < len(s.Data)
+}
+
+// MapROM maps data as a read-only segment starting at base.  Segments take
+// priority over RAM, WRAM, and the main ROM, but not over read and write
+// handlers.  Later segments take priority over earlier ones that overlap.
+// Writes follow the ROM write policy.  Like NewCore, the caller's slice is
+// used directly.  ErrLoadOverflow is returned if data runs past $FFFF.
+func (c *Core) MapROM(name string, base uint16, data []byte) error {
+	if int(base)+len(data) > 0x10000 {
+		return fmt.Errorf("%w: ROM segment %q with %d bytes at $%04X",
+			ErrLoadOverflow, name, len(data), base)
+	}
+
+	c.romSegments = append(c.romSegments, ROMSegment{Name: name, Base: base, Data: data})
+	return nil
+}
+
+// ROMSegments returns the segments added with MapROM, in the order they were
+// mapped.
+func (c *Core) ROMSegments() []ROMSegment {
+	return append([]ROMSegment(nil), c.romSegments...)
+}
+
+// romSegment returns the segment covering addr, or nil.
+func (c *Core) romSegment(addr uint16) *ROMSegment {
+	for i := len(c.romSegments) - 1; i >= 0; i-- {
+		if c.romSegments[i].contains(addr) {
+			return &c.romSegments[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package emu
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestROMSegments(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_AB, 0x10, 0x20,
+		OP_LDX_AB, 0x20, 0x40,
+		OP_LDY_AB, 0x00, 0x24,
+		OP_STA_AB, 0x11, 0x20,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.OpenBus = OpenBusConstant
+	core.OpenBusValue = 0xEE
+
+	chr := make([]byte, 0x400)
+	chr[0x10] = 0xC1
+	chr[0x11] = 0xC2
+	if err = core.MapROM("chr", 0x2000, chr); err != nil {
+		t.Fatal(err)
+	}
+
+	prog := make([]byte, 0x800)
+	prog[0x20] = 0x9A
+	if err = core.MapROM("prog", 0x4000, prog); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = core.RunUntil(0x800C, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.A != 0xC1 {
+		t.Errorf("Incorrect read from chr: Exp:$C1 Got:$%02X", core.A)
+	}
+
+	if core.X != 0x9A {
+		t.Errorf("Incorrect read from prog: Exp:$9A Got:$%02X", core.X)
+	}
+
+	if core.Y != 0xEE {
+		t.Errorf("Incorrect read from the gap: Exp:$EE Got:$%02X", core.Y)
+	}
+
+	if chr[0x11] != 0xC2 {
+		t.Errorf("Write reached a ROM segment: $%02X", chr[0x11])
+	}
+
+	segs := core.ROMSegments()
+	if len(segs) != 2 || segs[0].Name != "chr" || segs[1].Name != "prog" {
+		t.Fatalf("Incorrect segments: %v", segs)
+	}
+
+	if segs[1].End() != 0x47FF {
+		t.Errorf("Incorrect end: Exp:$47FF Got:$%04X", segs[1].End())
+	}
+
+	checkRegions(t, "segments", core.MemoryRegions(), []MemoryRegion{
+		{0x0000, 0x0FFF, MemRAM},
+		{0x1000, 0x1FFF, MemOpenBus},
+		{0x2000, 0x23FF, MemROM},
+		{0x2400, 0x3FFF, MemOpenBus},
+		{0x4000, 0x47FF, MemROM},
+		{0x4800, 0x7FFF, MemOpenBus},
+		{0x8000, 0xFFFF, MemROM},
+	})
+
+	err = core.MapROM("big", 0xFF00, make([]byte, 0x101))
+	if !errors.Is(err, ErrLoadOverflow) {
+		t.Errorf("Expected ErrLoadOverflow, got %v", err)
+	}
+}
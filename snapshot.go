@@ -0,0 +1,223 @@
+package emu
+
+import (
+	"errors"
+)
+
+var (
+	// ErrStateMismatch is returned by Restore when the saved memory doesn't
+	// match the layout of the core it's being restored into.
+	ErrStateMismatch = errors.New("State does not match core memory layout")
+
+	// ErrNoRewindHistory is returned by StepBack when there is no recorded
+	// state to go back to.
+	ErrNoRewindHistory = errors.New("No rewind history")
+)
+
+// CoreState is a copy of everything that changes while a core is running.
+// ROM is not included unless the core is a full RW core, where the ROM
+// slice is all of memory.
+type CoreState struct {
+	Registers
+
+	RAM      []byte // main RAM, or all 64k for a full RW core
+	WRAM     []byte
+	WRAMBank int
+
+	ROMOffset int // bank offset set by SetROMBank
+
+	Ticks     uint64
+	Cycles    uint64
+	CallDepth int
+}
+
+// Snapshot returns a copy of the current core state.
+func (c *Core) Snapshot() CoreState {
+	s := CoreState{}
+	c.snapshotInto(&s)
+	return s
+}
+
+// snapshotInto copies the current state into s, reusing its slices if they
+// are already the right size.
+func (c *Core) snapshotInto(s *CoreState) {
+	s.Registers = c.Registers()
+	s.RAM = copyInto(s.RAM, c.ram())
+	s.WRAM = copyInto(s.WRAM, c.wram)
+	s.WRAMBank = c.wramBank
+	s.ROMOffset = c.romOffset
+	s.Ticks = c.ticks
+	s.Cycles = c.cycles
+	s.CallDepth = c.callDepth
+}
+
+// Restore overwrites the core state with s.  The state must have come from
+// a core with the same memory layout.
+func (c *Core) Restore(s CoreState) error {
+	if len(s.RAM) != len(c.ram()) || len(s.WRAM) != len(c.wram) {
+		return ErrStateMismatch
+	}
+
+	c.SetRegisters(s.Registers)
+	copy(c.ram(), s.RAM)
+	copy(c.wram, s.WRAM)
+	c.wramBank = s.WRAMBank
+	c.romOffset = s.ROMOffset
+	c.ticks = s.Ticks
+	c.cycles = s.Cycles
+	c.callDepth = s.CallDepth
+
+	// Don't let the restored PC count towards the stuck detector.
+	c.lastPC = c.PC
+	c.lastSame = 0
+	c.jammed = false
+	c.waiting = false
+	c.stopped = false
+	return nil
+}
+
+// Clone returns an independent copy of the core, including RAM, WRAM, ROM,
+// ROM segments, and the coverage, rewind, and access log buffers.  Memory
+// handlers, traps, and hooks are shared with the original, so a handler with
+// its own state sees accesses from both cores.  Use ClearHooks on the clone
+// to remove them.
+func (c *Core) Clone() *Core {
+	n := *c
+	n.memory = copyInto(nil, c.memory)
+	n.rom = copyInto(nil, c.rom)
+	n.wram = copyInto(nil, c.wram)
+
+	if c.coverage != nil {
+		n.coverage = make([]bool, len(c.coverage))
+		copy(n.coverage, c.coverage)
+	}
+
+	if c.accessLog != nil {
+		n.accessLog = make([]MemAccess, len(c.accessLog))
+		copy(n.accessLog, c.accessLog)
+	}
+
+	if c.rewind != nil {
+		n.rewind = make([]CoreState, len(c.rewind))
+		for i, s := range c.rewind {
+			n.rewind[i] = s
+			n.rewind[i].RAM = copyInto(nil, s.RAM)
+			n.rewind[i].WRAM = copyInto(nil, s.WRAM)
+		}
+	}
+
+	if c.opcodeCounts != nil {
+		n.opcodeCounts = make(map[byte]uint64, len(c.opcodeCounts))
+		for k, v := range c.opcodeCounts {
+			n.opcodeCounts[k] = v
+		}
+	}
+
+	if c.instructions != nil {
+		n.instructions = make(map[byte]Instruction, len(c.instructions))
+		for k, v := range c.instructions {
+			n.instructions[k] = v
+		}
+	}
+
+	if c.traps != nil {
+		n.traps = make(map[byte]func(c *Core) bool, len(c.traps))
+		for k, v := range c.traps {
+			n.traps[k] = v
+		}
+	}
+
+	if c.romSegments != nil {
+		n.romSegments = make([]ROMSegment, len(c.romSegments))
+		for i, seg := range c.romSegments {
+			n.romSegments[i] = seg
+			n.romSegments[i].Data = copyInto(nil, seg.Data)
+		}
+	}
+
+	n.readHandlers = append([]readMapping(nil), c.readHandlers...)
+	n.writeHandlers = append([]writeMapping(nil), c.writeHandlers...)
+	return &n
+}
+
+// ClearHooks removes all memory handlers, traps, and hook functions from the
+// core.  DebugFile is left alone.
+func (c *Core) ClearHooks() {
+	c.readHandlers = nil
+	c.writeHandlers = nil
+	c.traps = nil
+	c.StackGuard = nil
+	c.StackHook = nil
+	c.FlagHook = nil
+	c.StuckHook = nil
+	c.PerCycleHook = nil
+}
+
+// ram returns the writable memory of the core.
+func (c *Core) ram() []byte {
+	if c.fullRW {
+		return c.rom
+	}
+	return c.memory
+}
+
+func copyInto(dst, src []byte) []byte {
+	if src == nil {
+		return nil
+	}
+
+	if len(dst) != len(src) {
+		dst = make([]byte, len(src))
+	}
+	copy(dst, src)
+	return dst
+}
+
+// Step executes a single instruction.
+func (c *Core) Step() error {
+	return c.tick()
+}
+
+// SetRewindDepth enables recording the core state before each instruction so
+// it can be restored with StepBack.  At most depth states are kept, with the
+// oldest being dropped first.  A depth of zero disables recording and drops
+// any recorded history.
+func (c *Core) SetRewindDepth(depth int) {
+	if depth <= 0 {
+		c.rewind = nil
+		c.rewindIdx = 0
+		c.rewindLen = 0
+		return
+	}
+
+	c.rewind = make([]CoreState, depth)
+	c.rewindIdx = 0
+	c.rewindLen = 0
+}
+
+// recordRewind saves the current state into the rewind buffer.  Slots are
+// reused once the buffer wraps so a full buffer doesn't allocate.
+func (c *Core) recordRewind() {
+	if c.rewind == nil {
+		return
+	}
+
+	c.snapshotInto(&c.rewind[c.rewindIdx])
+	c.rewindIdx = (c.rewindIdx + 1) % len(c.rewind)
+	if c.rewindLen < len(c.rewind) {
+		c.rewindLen++
+	}
+}
+
+// StepBack restores the state from before the last executed instruction.
+// ErrNoRewindHistory is returned if rewind isn't enabled or the history is
+// exhausted.
+func (c *Core) StepBack() error {
+	if c.rewindLen == 0 {
+		return ErrNoRewindHistory
+	}
+
+	c.rewindIdx = (c.rewindIdx - 1 + len(c.rewind)) % len(c.rewind)
+	c.rewindLen--
+	return c.Restore(c.rewind[c.rewindIdx])
+}
@@ -0,0 +1,183 @@
+package emu
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_IM, 0x42,
+		OP_STA_ZP, 0x10,
+		OP_INX,
+		OP_JMP_AB, 0x00, 0x80,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := core.Snapshot()
+	for i := 0; i < 3; i++ {
+		if err = core.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if core.memory[0x10] != 0x42 {
+		t.Fatalf("Incorrect memory value: Exp:$42 Got:$%02X", core.memory[0x10])
+	}
+
+	if err = core.Restore(saved); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.Registers() != saved.Registers {
+		t.Errorf("Incorrect registers:\nExp:%+v\nGot:%+v", saved.Registers, core.Registers())
+	}
+
+	if core.memory[0x10] != 0x00 {
+		t.Errorf("Incorrect memory value: Exp:$00 Got:$%02X", core.memory[0x10])
+	}
+
+	if core.Cycles() != 0 {
+		t.Errorf("Incorrect cycle count: Exp:0 Got:%d", core.Cycles())
+	}
+
+	// The snapshot must not alias the core's memory.
+	core.memory[0x20] = 0xAA
+	if saved.RAM[0x20] != 0x00 {
+		t.Errorf("Snapshot shares memory with the core")
+	}
+
+	other, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = other.Restore(saved); !errors.Is(err, ErrStateMismatch) {
+		t.Errorf("Expected ErrStateMismatch, got %v", err)
+	}
+}
+
+func TestStepBack(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_IM, 0x01,
+		OP_STA_ZP, 0x10,
+		OP_INC_ZP, 0x10,
+		OP_LDX_ZP, 0x10,
+		OP_JMP_AB, 0x00, 0x80,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = core.StepBack(); !errors.Is(err, ErrNoRewindHistory) {
+		t.Fatalf("Expected ErrNoRewindHistory, got %v", err)
+	}
+
+	core.SetRewindDepth(3)
+
+	states := []CoreState{}
+	for i := 0; i < 5; i++ {
+		states = append(states, core.Snapshot())
+		if err = core.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the last three states are kept.
+	for i := len(states) - 1; i >= len(states)-3; i-- {
+		if err = core.StepBack(); err != nil {
+			t.Fatalf("step back to %d: %v", i, err)
+		}
+
+		exp := states[i]
+		if core.Registers() != exp.Registers {
+			t.Errorf("step back to %d: Incorrect registers:\nExp:%+v\nGot:%+v", i, exp.Registers, core.Registers())
+		}
+
+		if !bytes.Equal(core.memory, exp.RAM) {
+			t.Errorf("step back to %d: Incorrect memory", i)
+		}
+
+		if core.Cycles() != exp.Cycles {
+			t.Errorf("step back to %d: Incorrect cycles: Exp:%d Got:%d", i, exp.Cycles, core.Cycles())
+		}
+	}
+
+	if err = core.StepBack(); !errors.Is(err, ErrNoRewindHistory) {
+		t.Errorf("Expected ErrNoRewindHistory, got %v", err)
+	}
+
+	// Stepping forward again after a rewind records new history.
+	if err = core.Step(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = core.StepBack(); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.Registers() != states[2].Registers {
+		t.Errorf("Incorrect registers:\nExp:%+v\nGot:%+v", states[2].Registers, core.Registers())
+	}
+}
+
+func TestClone(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_ZP, 0x20,
+		OP_BNE, 0x04,
+		OP_LDX_IM, 0x11,
+		OP_STX_ZP, 0x30,
+		OP_STA_AB, 0x00, 0x60, // $8008
+		OP_NOP, // $800B
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writes := 0
+	core.MapWrite(0x6000, 0x6000, func(addr uint16, value uint8) {
+		writes++
+	})
+
+	// Fork before the branch and send the clone down the other path.
+	clone := core.Clone()
+	clone.memory[0x20] = 0x01
+	clone.PokeByte(0x8005, 0x22)
+	clone.ClearHooks()
+
+	for _, c := range []*Core{core, clone} {
+		if err = c.RunUntil(0x800B, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if core.memory[0x20] != 0x00 || core.memory[0x30] != 0x11 {
+		t.Errorf("Clone shares RAM with the original: $20:$%02X $30:$%02X",
+			core.memory[0x20], core.memory[0x30])
+	}
+
+	if clone.memory[0x30] != 0x00 || clone.X != 0x00 {
+		t.Errorf("Clone took the wrong path: $30:$%02X X:$%02X", clone.memory[0x30], clone.X)
+	}
+
+	if core.PeekByte(0x8005) != 0x11 {
+		t.Errorf("Clone shares ROM with the original")
+	}
+
+	if writes != 1 {
+		t.Errorf("Incorrect handler writes: Exp:1 Got:%d", writes)
+	}
+
+	if clone.wram[0] != 0x01 || core.wram[0] != 0x00 {
+		t.Errorf("Incorrect WRAM: original:$%02X clone:$%02X", core.wram[0], clone.wram[0])
+	}
+}
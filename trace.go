@@ -0,0 +1,279 @@
+package emu
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// TraceFormat selects the format of the debug trace.
+type TraceFormat int
+
+const (
+	TraceText       TraceFormat = iota // fixed width text
+	TraceJSON                          // one JSON object per line
+	TraceVisual6502                    // columns of the visual6502 trace log
+)
+
+// TraceLevel selects how much of each instruction the text trace shows.
+// The zero value is TraceFull, so setting Debug alone gives the full trace.
+type TraceLevel int
+
+const (
+	TraceFull     TraceLevel = iota // instruction, registers, cycles, and stack
+	TraceOperands                   // instruction bytes and operands
+	TraceMnemonic                   // mnemonic only
+	TraceOff                        // nothing, even with Debug set
+)
+
+// TraceEntry is a single instruction in a JSON trace.  Registers and cycles
+// are the values after the instruction executed.
+type TraceEntry struct {
+	Tick     uint64 `json:"tick"`
+	PC       uint16 `json:"pc"`
+	Opcode   uint8  `json:"opcode"`
+	Mnemonic string `json:"mnemonic"`
+	Operands []int  `json:"operands"`
+	A        uint8  `json:"a"`
+	X        uint8  `json:"x"`
+	Y        uint8  `json:"y"`
+	SP       uint8  `json:"sp"`
+	P        uint8  `json:"p"`
+	Cycles   uint64 `json:"cycles"`
+}
+
+// tracing reports whether trace output is enabled.  Every kind of trace
+// line checks this, so TraceOff silences all of them.
+func (c *Core) tracing() bool {
+	return c.Debug && c.TraceLevel != TraceOff
+}
+
+// trace records the instruction that was just executed at oppc in the
+// history and writes it to DebugFile.  ops holds the instruction bytes
+// captured by instrBytes when it was decoded.  TraceLevel only applies to
+// the text format; JSON entries always have every field.
+func (c *Core) trace(instr Instruction, oppc uint16, ops []uint8) {
+	if !c.tracing() {
+		return
+	}
+
+	var line string
+	switch c.TraceFormat {
+	case TraceJSON:
+		line = c.jsonTraceLine(instr, oppc, ops)
+	case TraceVisual6502:
+		line = c.visual6502TraceLine(instr, oppc, ops)
+	default:
+		line = c.textTraceLine(instr, oppc, ops)
+	}
+
+	c.history[c.historyIdx] = line
+	c.historyIdx += 1
+	if c.historyIdx >= HistoryLength {
+		c.historyIdx = 0
+	}
+
+	if c.DebugFile != nil {
+		fmt.Fprintln(c.DebugFile, line)
+	}
+}
+
+// instrBytes returns the bytes of the instruction at oppc, starting with
+// opcode, which has already been fetched.  tick captures them once before
+// the instruction executes so the trace doesn't read them again.
+func (c *Core) instrBytes(opcode byte, instr Instruction, oppc uint16) []uint8 {
+	l := c.instrLength(opcode, instr)
+	ops := make([]uint8, l)
+	ops[0] = opcode
+	for i := uint8(1); i < l; i++ {
+		ops[i] = c.PeekByte(oppc + uint16(i))
+	}
+	return ops
+}
+
+// Instructions that do decimal math when the D flag is set.  The text trace
+// marks them with [BCD] in decimal mode.
+var bcdInstructions = map[string]bool{
+	"ADC": true,
+	"SBC": true,
+}
+
+func (c *Core) textTraceLine(instr Instruction, oppc uint16, ops []uint8) string {
+	line := c.textTraceInstr(instr, oppc, ops)
+	if c.Phlags&FLAG_DECIMAL != 0 && bcdInstructions[instr.Name()] {
+		line += " [BCD]"
+	}
+	return line
+}
+
+func (c *Core) textTraceInstr(instr Instruction, oppc uint16, ops []uint8) string {
+	hex := []string{}
+	for _, b := range ops {
+		hex = append(hex, fmt.Sprintf("%02X", b))
+	}
+
+	switch c.TraceLevel {
+	case TraceMnemonic:
+		return fmt.Sprintf("[%06d] $%04X: %s", c.ticks, oppc, instr.Name())
+
+	case TraceOperands:
+		return strings.TrimSpace(fmt.Sprintf("[%06d] $%04X: %-9s %s %s",
+			c.ticks,
+			oppc,
+			strings.Join(hex, " "),
+			instr.Name(),
+			instr.AddressMeta().Asm(c, oppc),
+		))
+	}
+
+	return fmt.Sprintf("[%06d] $%04X: %-9s %s %-17s %s CYC:%-6d %s",
+		c.ticks,
+		oppc,
+		strings.Join(hex, " "),
+		instr.Name(),
+		instr.AddressMeta().Asm(c, oppc), // oppc == OP code PC
+		c.registerString(),
+		c.cycles,
+		c.stackString(),
+	)
+}
+
+func (c *Core) jsonTraceLine(instr Instruction, oppc uint16, ops []uint8) string {
+	entry := TraceEntry{
+		Tick:     c.ticks,
+		PC:       oppc,
+		Opcode:   ops[0],
+		Mnemonic: instr.Name(),
+		Operands: []int{},
+		A:        c.A,
+		X:        c.X,
+		Y:        c.Y,
+		SP:       c.SP,
+		P:        c.Phlags,
+		Cycles:   c.cycles,
+	}
+
+	for _, op := range ops[1:] {
+		entry.Operands = append(entry.Operands, int(op))
+	}
+
+	// None of the fields can fail to marshal.
+	line, _ := json.Marshal(entry)
+	return string(line)
+}
+
+// Visual6502Header names the columns of a TraceVisual6502 trace.
+const Visual6502Header = "cycle\tab\tdb\trw\tFetch\tpc\ta\tx\ty\ts\tp"
+
+// Operand notation used by visual6502 in the Fetch column.  Modes that
+// aren't listed show the mnemonic alone.
+var visual6502Modes = map[string]string{
+	ADDR_Absolute.Name:          "Abs",
+	ADDR_AbsoluteX.Name:         "Abs,X",
+	ADDR_AbsoluteY.Name:         "Abs,Y",
+	ADDR_Accumulator.Name:       "A",
+	ADDR_Immediate.Name:         "#",
+	ADDR_Indirect.Name:          "(Abs)",
+	ADDR_AbsoluteIndirectX.Name: "(Abs,X)",
+	ADDR_IndirectX.Name:         "(zp,X)",
+	ADDR_IndirectY.Name:         "(zp),Y",
+	ADDR_IndirectZP.Name:        "(zp)",
+	ADDR_ZeroPage.Name:          "zp",
+	ADDR_ZeroPageX.Name:         "zp,X",
+	ADDR_ZeroPageY.Name:         "zp,Y",
+	ADDR_ZeroPageRelative.Name:  "zp,rel",
+}
+
+// visual6502TraceLine formats the opcode fetch of the instruction at oppc as
+// a row of the visual6502 trace log: the cycle, address bus, data bus,
+// read/write line, fetched instruction, and registers, tab separated with
+// lowercase hex.  It must be called before the instruction executes, since
+// visual6502 shows the state at the fetch.
+func (c *Core) visual6502TraceLine(instr Instruction, oppc uint16, ops []uint8) string {
+	fetch := instr.Name()
+	if mode, ok := visual6502Modes[instr.AddressMeta().Name]; ok {
+		fetch += " " + mode
+	}
+
+	return fmt.Sprintf("%d\t%04x\t%02x\t1\t%s\t%04x\t%02x\t%02x\t%02x\t%02x\t%s",
+		c.cycles,
+		oppc,
+		ops[0],
+		fetch,
+		oppc,
+		c.A,
+		c.X,
+		c.Y,
+		c.SP,
+		visual6502Flags(c.Phlags),
+	)
+}
+
+// visual6502Flags shows the status register as visual6502 does, with set
+// flags in upper case.  The B flag has no storage and always reads as set.
+func visual6502Flags(p uint8) string {
+	names := "nv-bdizc"
+	out := []byte(names)
+	for i := range out {
+		bit := uint8(0x80) >> uint(i)
+		if p&bit != 0 || bit == 0x10 {
+			out[i] = names[i] - 'a' + 'A'
+		}
+	}
+	out[2] = '-'
+	return string(out)
+}
+
+// Flags reported by FlagHook and TraceFlags, in display order.
+var flagNames = []struct {
+	flag uint8
+	name string
+}{
+	{FLAG_NEGATIVE, "N"},
+	{FLAG_OVERFLOW, "V"},
+	{FLAG_DECIMAL, "D"},
+	{FLAG_INTERRUPT, "I"},
+	{FLAG_ZERO, "Z"},
+	{FLAG_CARRY, "C"},
+}
+
+// FlagChange is a single flag change in a JSON trace.
+type FlagChange struct {
+	Tick uint64 `json:"tick"`
+	PC   uint16 `json:"pc"`
+	Flag string `json:"flag"`
+	Set  bool   `json:"set"`
+}
+
+// flagChanges reports the flags that differ between prev and the current
+// status register for the instruction at oppc.
+func (c *Core) flagChanges(oppc uint16, prev uint8) {
+	for _, f := range flagNames {
+		was := prev&f.flag != 0
+		now := c.Phlags&f.flag != 0
+		if was == now {
+			continue
+		}
+
+		if c.FlagHook != nil {
+			c.FlagHook(c, oppc, f.flag, was, now)
+		}
+
+		if c.TraceFlags && c.tracing() && c.DebugFile != nil {
+			fmt.Fprintln(c.DebugFile, c.flagTraceLine(oppc, f.name, now))
+		}
+	}
+}
+
+func (c *Core) flagTraceLine(oppc uint16, name string, set bool) string {
+	if c.TraceFormat == TraceJSON {
+		line, _ := json.Marshal(FlagChange{Tick: c.ticks, PC: oppc, Flag: name, Set: set})
+		return string(line)
+	}
+
+	change := "cleared"
+	if set {
+		change = "set"
+	}
+	return fmt.Sprintf("[%06d] $%04X: flag %s %s", c.ticks, oppc, name, change)
+}
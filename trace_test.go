@@ -0,0 +1,244 @@
+package emu
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestJSONTrace(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_IM, 0x80,
+		OP_STA_AB, 0x00, 0x03,
+		OP_INX,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	core.Debug = true
+	core.DebugFile = buf
+	core.TraceFormat = TraceJSON
+
+	if err = core.RunUntil(0x8006, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []TraceEntry{
+		{Tick: 1, PC: 0x8000, Opcode: OP_LDA_IM, Mnemonic: "LDA", Operands: []int{0x80}, A: 0x80, P: FLAG_NEGATIVE, Cycles: 2},
+		{Tick: 2, PC: 0x8002, Opcode: OP_STA_AB, Mnemonic: "STA", Operands: []int{0x00, 0x03}, A: 0x80, P: FLAG_NEGATIVE, Cycles: 6},
+		{Tick: 3, PC: 0x8005, Opcode: OP_INX, Mnemonic: "INX", Operands: []int{}, A: 0x80, X: 0x01, Cycles: 8},
+	}
+
+	scanner := bufio.NewScanner(buf)
+	i := 0
+	for ; scanner.Scan(); i++ {
+		if i >= len(exp) {
+			t.Fatalf("Too many trace lines: %q", scanner.Text())
+		}
+
+		got := TraceEntry{}
+		if err = json.Unmarshal(scanner.Bytes(), &got); err != nil {
+			t.Fatalf("Line %d is not valid JSON: %v: %q", i, err, scanner.Text())
+		}
+
+		gotJSON, _ := json.Marshal(got)
+		expJSON, _ := json.Marshal(exp[i])
+		if !bytes.Equal(gotJSON, expJSON) {
+			t.Errorf("Incorrect trace entry %d:\nExp:%s\nGot:%s", i, expJSON, gotJSON)
+		}
+	}
+
+	if i != len(exp) {
+		t.Errorf("Incorrect number of trace lines: Exp:%d Got:%d", len(exp), i)
+	}
+}
+
+// Each instruction is a row of the visual6502 trace log at its opcode fetch,
+// showing the registers before it runs.
+func TestVisual6502Trace(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_IM, 0x80,
+		OP_STA_AB, 0x00, 0x03,
+		OP_INX,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.SP = 0xFD
+	core.Phlags = FLAG_INTERRUPT
+
+	buf := &bytes.Buffer{}
+	core.Debug = true
+	core.DebugFile = buf
+	core.TraceFormat = TraceVisual6502
+
+	if err = core.RunUntil(0x8006, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{
+		"0\t8000\ta9\t1\tLDA #\t8000\t00\t00\t00\tfd\tnv-BdIzc",
+		"2\t8002\t8d\t1\tSTA Abs\t8002\t80\t00\t00\tfd\tNv-BdIzc",
+		"6\t8005\te8\t1\tINX\t8005\t80\t00\t00\tfd\tNv-BdIzc",
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(exp) {
+		t.Fatalf("Incorrect number of trace lines: Exp:%d Got:%d\n%s", len(exp), len(lines), buf.String())
+	}
+
+	for i := range exp {
+		if lines[i] != exp[i] {
+			t.Errorf("Incorrect line %d:\nExp:%q\nGot:%q", i, exp[i], lines[i])
+		}
+	}
+
+	if cols := strings.Split(Visual6502Header, "\t"); len(cols) != len(strings.Split(exp[0], "\t")) {
+		t.Errorf("Header has %d columns, rows have %d", len(cols), len(strings.Split(exp[0], "\t")))
+	}
+}
+
+func TestFlagChanges(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_LDA_IM, 0x80,
+		OP_LDA_IM, 0x00,
+		OP_SEC,
+		OP_INX,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := []string{}
+	core.FlagHook = func(c *Core, pc uint16, flag uint8, oldValue, newValue bool) {
+		changes = append(changes, fmt.Sprintf("$%04X %02X %t->%t", pc, flag, oldValue, newValue))
+	}
+
+	buf := &bytes.Buffer{}
+	core.Debug = true
+	core.DebugFile = buf
+	core.TraceFlags = true
+
+	if err = core.RunUntil(0x8006, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{
+		"$8000 80 false->true",
+		"$8002 80 true->false",
+		"$8002 02 false->true",
+		"$8004 01 false->true",
+		"$8005 02 true->false",
+	}
+
+	if strings.Join(changes, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("Incorrect flag changes:\nExp:%q\nGot:%q", exp, changes)
+	}
+
+	expTrace := []string{
+		"[000001] $8000: flag N set",
+		"[000002] $8002: flag N cleared",
+		"[000002] $8002: flag Z set",
+		"[000003] $8004: flag C set",
+		"[000004] $8005: flag Z cleared",
+	}
+
+	got := []string{}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(line, ": flag ") {
+			got = append(got, line)
+		}
+	}
+
+	if strings.Join(got, "\n") != strings.Join(expTrace, "\n") {
+		t.Errorf("Incorrect flag trace:\nExp:%q\nGot:%q", expTrace, got)
+	}
+}
+
+func TestTraceLevel(t *testing.T) {
+	rom := PadWithVectors([]byte{OP_LDA_IM, 0x80}, 0x8000, 0x8000, 0x8000)
+
+	// TraceFlags output follows the level too.
+	flag := "\n[000001] $8000: flag N set"
+	tests := []struct {
+		level TraceLevel
+		line  string
+	}{
+		{TraceOff, ""},
+		{TraceMnemonic, "[000001] $8000: LDA" + flag},
+		{TraceOperands, "[000001] $8000: A9 80     LDA #$80" + flag},
+		{TraceFull, "[000001] $8000: A9 80     LDA #$80              " +
+			"A: 80 (128) X: 00 (0  ) Y: 00 (0  ) SP: FD (253) [80] N------- CYC:2      $00 $00" + flag},
+	}
+
+	for _, tc := range tests {
+		core, err := NewCore(rom, false, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf := &bytes.Buffer{}
+		core.Debug = true
+		core.DebugFile = buf
+		core.TraceLevel = tc.level
+		core.TraceFlags = true
+		core.SP = 0xFD
+
+		if err = core.Step(); err != nil {
+			t.Fatal(err)
+		}
+
+		got := strings.TrimSuffix(buf.String(), "\n")
+		if got != tc.line {
+			t.Errorf("Level %d: Incorrect trace:\nExp:%q\nGot:%q", tc.level, tc.line, got)
+		}
+	}
+}
+
+func TestTraceBCD(t *testing.T) {
+	rom := PadWithVectors([]byte{
+		OP_ADC_IM, 0x05,
+		OP_SED,
+		OP_ADC_IM, 0x05,
+		OP_SBC_IM, 0x01,
+		OP_LDA_IM, 0x00,
+		OP_CLD,
+		OP_SBC_IM, 0x01,
+	}, 0x8000, 0x8000, 0x8000)
+
+	core, err := NewCore(rom, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	core.Debug = true
+	core.DebugFile = buf
+	core.TraceLevel = TraceMnemonic
+
+	if err = core.RunUntil(0x800C, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := "[000001] $8000: ADC\n" +
+		"[000002] $8002: SED\n" +
+		"[000003] $8003: ADC [BCD]\n" +
+		"[000004] $8005: SBC [BCD]\n" +
+		"[000005] $8007: LDA\n" +
+		"[000006] $8009: CLD\n" +
+		"[000007] $800A: SBC\n"
+	if buf.String() != exp {
+		t.Errorf("Incorrect trace:\nExp:%q\nGot:%q", exp, buf.String())
+	}
+}